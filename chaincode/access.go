@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+const (
+	roleAttribute = "role"
+	RoleAdmin     = "election-admin"
+	RoleVoter     = "voter"
+	// RoleMaintainer may only run housekeeping such as CompactTally, so the
+	// web app can do it without holding election-admin credentials.
+	RoleMaintainer = "tally-maintainer"
+)
+
+// adminMSPs lists the organizations whose identities may hold the admin role.
+var adminMSPs = map[string]bool{
+	"Org1MSP": true,
+}
+
+// transactionRoles maps each restricted transaction to the role it requires.
+// Transactions not listed here are open to any identity on the channel.
+var transactionRoles = map[string]string{
+	"InitLedger":         RoleAdmin,
+	"CreateElection":     RoleAdmin,
+	"OpenElection":       RoleAdmin,
+	"CloseElection":      RoleAdmin,
+	"CertifyElection":    RoleAdmin,
+	"AddCandidate":       RoleAdmin,
+	"UpdateCandidate":    RoleAdmin,
+	"WithdrawCandidate":  RoleAdmin,
+	"EnableCommitReveal": RoleAdmin,
+	"CompactTally":       RoleMaintainer,
+	"AddVote":            RoleVoter,
+	"AddRankedVote":      RoleVoter,
+	"AddApprovalVote":    RoleVoter,
+	"AddScoreVote":       RoleVoter,
+	"CommitVote":         RoleVoter,
+	"RevealVote":         RoleVoter,
+}
+
+// isAdmin reports whether the submitting identity may manage elections: it
+// must belong to one of adminMSPs and either carry role=election-admin or be
+// an MSP admin (NodeOU "admin"), which is how the test network's Admin@
+// identities are issued.
+func isAdmin(ctx contractapi.TransactionContextInterface) (bool, error) {
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return false, err
+	}
+	if !adminMSPs[mspID] {
+		return false, nil
+	}
+	role, found, err := ctx.GetClientIdentity().GetAttributeValue(roleAttribute)
+	if err != nil {
+		return false, err
+	}
+	if found && role == RoleAdmin {
+		return true, nil
+	}
+	cert, err := ctx.GetClientIdentity().GetX509Certificate()
+	if err != nil {
+		return false, err
+	}
+	if cert == nil {
+		return false, nil
+	}
+	for _, ou := range cert.Subject.OrganizationalUnit {
+		if ou == "admin" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func hasRole(ctx contractapi.TransactionContextInterface, role string) (bool, error) {
+	if role == RoleAdmin {
+		return isAdmin(ctx)
+	}
+	if role == RoleMaintainer {
+		admin, err := isAdmin(ctx)
+		if err != nil || admin {
+			return admin, err
+		}
+	}
+	value, found, err := ctx.GetClientIdentity().GetAttributeValue(roleAttribute)
+	if err != nil {
+		return false, err
+	}
+	return found && value == role, nil
+}
+
+// checkAccess runs before every transaction and rejects callers that lack the
+// role transactionRoles requires for the invoked function.
+func checkAccess(ctx contractapi.TransactionContextInterface) error {
+	function, _ := ctx.GetStub().GetFunctionAndParameters()
+	if i := strings.LastIndex(function, ":"); i >= 0 {
+		function = function[i+1:]
+	}
+	role, ok := transactionRoles[function]
+	if !ok {
+		return nil
+	}
+	allowed, err := hasRole(ctx, role)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return fmt.Errorf("%s requires the %s role", function, role)
+	}
+	return nil
+}
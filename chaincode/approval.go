@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// AddApprovalVote records a ballot approving each candidate in the transient
+// ballot, up to the election's limit when it has one.
+func (pc *VoteSmartContract) AddApprovalVote(ctx contractapi.TransactionContextInterface, electionID string) (*Receipt, error) {
+	return pc.addBallot(ctx, electionID, BallotApproval)
+}
+
+func (pc *VoteSmartContract) approvalBallot(ctx contractapi.TransactionContextInterface, election *Election, ballotJSON []byte) (*Vote, error) {
+	var approvals []string
+	err := json.Unmarshal(ballotJSON, &approvals)
+	if err != nil {
+		return nil, err
+	}
+	if len(approvals) == 0 {
+		return nil, fmt.Errorf("approval ballot must approve at least one candidate")
+	}
+	if election.Limit > 0 && len(approvals) > election.Limit {
+		return nil, fmt.Errorf("approval ballot may approve at most %d candidates", election.Limit)
+	}
+	seen := map[string]bool{}
+	for _, candidate := range approvals {
+		if seen[candidate] {
+			return nil, fmt.Errorf("candidate %s is approved more than once", candidate)
+		}
+		seen[candidate] = true
+		err = pc.assertCandidate(ctx, election.ID, candidate)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &Vote{Approvals: approvals}, nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+const candidateObjectType = "candidate"
+
+type Candidate struct {
+	ID          string `json:"id"`
+	ElectionID  string `json:"electionId"`
+	Name        string `json:"name"`
+	Image       string `json:"image"`
+	Description string `json:"description"`
+	Withdrawn   bool   `json:"withdrawn"`
+}
+
+func candidateKey(ctx contractapi.TransactionContextInterface, electionID string, id string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(candidateObjectType, []string{electionID, id})
+}
+
+func putCandidate(ctx contractapi.TransactionContextInterface, candidate *Candidate) error {
+	key, err := candidateKey(ctx, candidate.ElectionID, candidate.ID)
+	if err != nil {
+		return err
+	}
+	candidateJSON, err := json.Marshal(candidate)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(key, candidateJSON)
+}
+
+// registerCandidate stores candidate as one of election's and adds it to the
+// election's candidate list. The caller writes the election.
+func registerCandidate(ctx contractapi.TransactionContextInterface, election *Election, candidate *Candidate) error {
+	if candidate.ID == "" {
+		return fmt.Errorf("candidate id must not be empty")
+	}
+	// The list also catches candidates registered earlier in this
+	// transaction, whose writes GetState does not see.
+	for _, id := range election.Candidates {
+		if id == candidate.ID {
+			return fmt.Errorf("candidate %s already exists in election %s", candidate.ID, election.ID)
+		}
+	}
+	key, err := candidateKey(ctx, election.ID, candidate.ID)
+	if err != nil {
+		return err
+	}
+	existing, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("candidate %s already exists in election %s", candidate.ID, election.ID)
+	}
+	candidate.ElectionID = election.ID
+	err = putCandidate(ctx, candidate)
+	if err != nil {
+		return err
+	}
+	election.Candidates = append(election.Candidates, candidate.ID)
+	return nil
+}
+
+func (pc *VoteSmartContract) AddCandidate(ctx contractapi.TransactionContextInterface, electionID string, id string, name string, image string, description string) error {
+	election, err := pc.draftElection(ctx, electionID)
+	if err != nil {
+		return err
+	}
+	candidate := Candidate{
+		ID:          id,
+		Name:        name,
+		Image:       image,
+		Description: description,
+	}
+	err = registerCandidate(ctx, election, &candidate)
+	if err != nil {
+		return err
+	}
+	err = putElection(ctx, election)
+	if err != nil {
+		return err
+	}
+	return setEvent(ctx, EventCandidateAdded, &Event{ElectionID: electionID, CandidateID: id})
+}
+
+func (pc *VoteSmartContract) UpdateCandidate(ctx contractapi.TransactionContextInterface, electionID string, id string, name string, image string, description string) error {
+	_, err := pc.draftElection(ctx, electionID)
+	if err != nil {
+		return err
+	}
+	candidate, err := pc.GetCandidate(ctx, electionID, id)
+	if err != nil {
+		return err
+	}
+	candidate.Name = name
+	candidate.Image = image
+	candidate.Description = description
+	return putCandidate(ctx, candidate)
+}
+
+// WithdrawCandidate keeps the candidate on the ledger so existing votes still
+// resolve, but AddVote no longer accepts ballots for it. A candidate can drop
+// out while voting is open, but not once it has closed, since instant-runoff
+// counts skip withdrawn candidates and would change the result.
+func (pc *VoteSmartContract) WithdrawCandidate(ctx contractapi.TransactionContextInterface, electionID string, id string) error {
+	election, err := pc.GetElection(ctx, electionID)
+	if err != nil {
+		return err
+	}
+	if election.Status != ElectionDraft && election.Status != ElectionOpen {
+		return fmt.Errorf("election %s is %s, candidates can no longer withdraw", electionID, election.Status)
+	}
+	candidate, err := pc.GetCandidate(ctx, electionID, id)
+	if err != nil {
+		return err
+	}
+	candidate.Withdrawn = true
+	return putCandidate(ctx, candidate)
+}
+
+// draftElection returns the election if its candidates may still be added or
+// changed, which ends when it opens so that every voter sees the same ballot.
+func (pc *VoteSmartContract) draftElection(ctx contractapi.TransactionContextInterface, electionID string) (*Election, error) {
+	election, err := pc.GetElection(ctx, electionID)
+	if err != nil {
+		return nil, err
+	}
+	if election.Status != ElectionDraft {
+		return nil, fmt.Errorf("election %s is %s, candidates can only change while it is a draft", electionID, election.Status)
+	}
+	return election, nil
+}
+
+func (pc *VoteSmartContract) GetCandidate(ctx contractapi.TransactionContextInterface, electionID string, id string) (*Candidate, error) {
+	key, err := candidateKey(ctx, electionID, id)
+	if err != nil {
+		return nil, err
+	}
+	candidateJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, err
+	}
+	if candidateJSON == nil {
+		return nil, fmt.Errorf("candidate %s does not exist in election %s", id, electionID)
+	}
+	var candidate *Candidate
+	err = json.Unmarshal(candidateJSON, &candidate)
+	if err != nil {
+		return nil, err
+	}
+	return candidate, nil
+}
+
+func (pc *VoteSmartContract) ListCandidates(ctx contractapi.TransactionContextInterface, electionID string) ([]*Candidate, error) {
+	candidateIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(candidateObjectType, []string{electionID})
+	if err != nil {
+		return nil, err
+	}
+	defer candidateIterator.Close()
+	var candidates []*Candidate
+	for candidateIterator.HasNext() {
+		candidateResponse, err := candidateIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var candidate *Candidate
+		err = json.Unmarshal(candidateResponse.Value, &candidate)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, candidate)
+	}
+	return candidates, nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+func TestCandidateChangesFollowElectionStatus(t *testing.T) {
+	pc := &VoteSmartContract{}
+	ctx, stub := newTestContext()
+
+	step := func(txID string, call func() error, allowed bool) {
+		t.Helper()
+		stub.MockTransactionStart(txID)
+		defer stub.MockTransactionEnd(txID)
+		err := call()
+		if allowed && err != nil {
+			t.Errorf("%s: %v", txID, err)
+		}
+		if !allowed && err == nil {
+			t.Errorf("%s succeeded, want an error", txID)
+		}
+	}
+
+	step("create", func() error {
+		return pc.CreateElection(ctx, "lunch", "Lunch", BallotPlurality, 0, 0, 0, false, []string{"pizza", "tacos", "salad"})
+	}, true)
+	step("add while draft", func() error { return pc.AddCandidate(ctx, "lunch", "soup", "Soup", "", "") }, true)
+	step("update while draft", func() error { return pc.UpdateCandidate(ctx, "lunch", "pizza", "Pizza", "", "") }, true)
+
+	step("open", func() error { return pc.OpenElection(ctx, "lunch") }, true)
+	step("add while open", func() error { return pc.AddCandidate(ctx, "lunch", "curry", "Curry", "", "") }, false)
+	step("update while open", func() error { return pc.UpdateCandidate(ctx, "lunch", "pizza", "Calzone", "", "") }, false)
+	step("withdraw while open", func() error { return pc.WithdrawCandidate(ctx, "lunch", "salad") }, true)
+
+	step("close", func() error { return pc.CloseElection(ctx, "lunch") }, true)
+	step("add while closed", func() error { return pc.AddCandidate(ctx, "lunch", "curry", "Curry", "", "") }, false)
+	step("update while closed", func() error { return pc.UpdateCandidate(ctx, "lunch", "pizza", "Calzone", "", "") }, false)
+	step("withdraw while closed", func() error { return pc.WithdrawCandidate(ctx, "lunch", "tacos") }, false)
+
+	candidate, err := pc.GetCandidate(ctx, "lunch", "pizza")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if candidate.Name != "Pizza" {
+		t.Errorf("candidate name = %q, want Pizza", candidate.Name)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+const commitmentObjectType = "commitment"
+
+// Commitment is a sealed ballot in a commit-reveal election. Hash is the hex
+// SHA-256 of the salt followed by the ballot JSON, so nothing about the ballot
+// is known until RevealVote supplies both.
+type Commitment struct {
+	ID         string `json:"id"`
+	ElectionID string `json:"electionId"`
+	Hash       string `json:"hash"`
+	Revealed   bool   `json:"revealed"`
+}
+
+func commitmentHash(ballotJSON []byte, salt string) string {
+	sum := sha256.Sum256(append([]byte(salt), ballotJSON...))
+	return hex.EncodeToString(sum[:])
+}
+
+func putCommitment(ctx contractapi.TransactionContextInterface, commitment *Commitment) error {
+	key, err := ctx.GetStub().CreateCompositeKey(commitmentObjectType, []string{commitment.ElectionID, commitment.ID})
+	if err != nil {
+		return err
+	}
+	commitmentJSON, err := json.Marshal(commitment)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(key, commitmentJSON)
+}
+
+func getCommitment(ctx contractapi.TransactionContextInterface, electionID string, id string) (*Commitment, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(commitmentObjectType, []string{electionID, id})
+	if err != nil {
+		return nil, err
+	}
+	commitmentJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, err
+	}
+	if commitmentJSON == nil {
+		return nil, fmt.Errorf("commitment %s does not exist in election %s", id, electionID)
+	}
+	var commitment *Commitment
+	err = json.Unmarshal(commitmentJSON, &commitment)
+	if err != nil {
+		return nil, err
+	}
+	return commitment, nil
+}
+
+// countUnrevealed returns how many of the election's commitments have not been
+// revealed and so are missing from its tally.
+func countUnrevealed(ctx contractapi.TransactionContextInterface, electionID string) (int, error) {
+	commitmentIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(commitmentObjectType, []string{electionID})
+	if err != nil {
+		return 0, err
+	}
+	defer commitmentIterator.Close()
+	unrevealed := 0
+	for commitmentIterator.HasNext() {
+		commitmentResponse, err := commitmentIterator.Next()
+		if err != nil {
+			return 0, err
+		}
+		var commitment Commitment
+		err = json.Unmarshal(commitmentResponse.Value, &commitment)
+		if err != nil {
+			return 0, err
+		}
+		if !commitment.Revealed {
+			unrevealed++
+		}
+	}
+	return unrevealed, nil
+}
+
+// EnableCommitReveal switches a draft election to commit-reveal voting. Voters
+// then cast CommitVote while it is open and RevealVote once voting has ended,
+// up to revealClosesAt (Unix seconds, zero for until certification).
+func (pc *VoteSmartContract) EnableCommitReveal(ctx contractapi.TransactionContextInterface, electionID string, revealClosesAt int64) error {
+	election, err := pc.GetElection(ctx, electionID)
+	if err != nil {
+		return err
+	}
+	if election.Status != ElectionDraft {
+		return fmt.Errorf("election %s is %s, expected %s", electionID, election.Status, ElectionDraft)
+	}
+	if revealClosesAt != 0 && election.ClosesAt != 0 && revealClosesAt <= election.ClosesAt {
+		return fmt.Errorf("election %s reveal window closes before voting does", electionID)
+	}
+	election.CommitReveal = true
+	election.RevealClosesAt = revealClosesAt
+	return putElection(ctx, election)
+}
+
+// CommitVote records the commitment hash and voter pseudonym passed in the
+// transient map and returns the commitment ID needed to reveal the ballot.
+func (pc *VoteSmartContract) CommitVote(ctx contractapi.TransactionContextInterface, electionID string) (string, error) {
+	election, err := pc.votingElection(ctx, electionID)
+	if err != nil {
+		return "", err
+	}
+	if !election.CommitReveal {
+		return "", fmt.Errorf("election %s does not take committed ballots", electionID)
+	}
+	transient, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return "", err
+	}
+	hash := string(transient[transientCommitment])
+	decoded, err := hex.DecodeString(hash)
+	if err != nil || len(decoded) != sha256.Size {
+		return "", fmt.Errorf("commitment must be passed in the transient field %s as a hex SHA-256 hash", transientCommitment)
+	}
+	err = markVoted(ctx, electionID, string(transient[transientVoter]))
+	if err != nil {
+		return "", err
+	}
+	commitment := Commitment{
+		ID:         ctx.GetStub().GetTxID(),
+		ElectionID: electionID,
+		Hash:       hash,
+	}
+	err = putCommitment(ctx, &commitment)
+	if err != nil {
+		return "", err
+	}
+	return commitment.ID, nil
+}
+
+// RevealVote counts the ballot behind a commitment. The ballot and salt are
+// read from the transient map and must hash to the committed value. The
+// receipt refers to the vote by its commitment ID.
+func (pc *VoteSmartContract) RevealVote(ctx contractapi.TransactionContextInterface, electionID string, commitmentID string) (*Receipt, error) {
+	election, err := pc.GetElection(ctx, electionID)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !election.acceptsReveals(now) {
+		return nil, fmt.Errorf("election %s is not accepting reveals", electionID)
+	}
+	commitment, err := getCommitment(ctx, electionID, commitmentID)
+	if err != nil {
+		return nil, err
+	}
+	if commitment.Revealed {
+		return nil, fmt.Errorf("commitment %s has already been revealed", commitmentID)
+	}
+	ballotJSON, _, salt, err := readTransient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if commitmentHash(ballotJSON, salt) != commitment.Hash {
+		return nil, fmt.Errorf("ballot does not match commitment %s", commitmentID)
+	}
+	vote, err := pc.decodeBallot(ctx, election, ballotJSON)
+	if err != nil {
+		return nil, err
+	}
+	vote.ID = commitment.ID
+	vote.ElectionID = electionID
+	vote.Salt = salt
+	receipt, err := pc.recordVote(ctx, vote)
+	if err != nil {
+		return nil, err
+	}
+	commitment.Revealed = true
+	return receipt, putCommitment(ctx, commitment)
+}
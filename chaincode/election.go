@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+const (
+	electionObjectType = "election"
+
+	ElectionDraft     = "draft"
+	ElectionOpen      = "open"
+	ElectionClosed    = "closed"
+	ElectionCertified = "certified"
+
+	BallotPlurality = "plurality"
+	BallotRanked    = "ranked"
+	BallotApproval  = "approval"
+	BallotScore     = "score"
+)
+
+// Election moves through Draft -> Open -> Closed -> Certified. OpensAt and
+// ClosesAt are Unix seconds compared against the transaction timestamp; zero
+// leaves that side of the voting window unbounded. Limit caps approval ballots
+// at that many candidates (zero for any number) and is the highest score a
+// score ballot may give. CommitReveal elections take sealed commitments while
+// open and count ballots only once they are revealed, between voting closing
+// and RevealClosesAt (zero for until certification). Candidates lists the IDs
+// of the election's candidates in the order they were added, withdrawn ones
+// included; the candidates themselves are separate assets.
+type Election struct {
+	ID         string `json:"id"`
+	Title      string `json:"title"`
+	OpensAt    int64  `json:"opensAt"`
+	ClosesAt   int64  `json:"closesAt"`
+	Status     string `json:"status"`
+	HideTally  bool   `json:"hideTally"`
+	BallotType string `json:"ballotType,omitempty"`
+	Limit      int    `json:"limit,omitempty"`
+
+	Candidates []string `json:"candidates"`
+
+	CommitReveal   bool  `json:"commitReveal,omitempty"`
+	RevealClosesAt int64 `json:"revealClosesAt,omitempty"`
+}
+
+// ballotType defaults elections created before ballot types existed to
+// plurality.
+func (e *Election) ballotType() string {
+	if e.BallotType == "" {
+		return BallotPlurality
+	}
+	return e.BallotType
+}
+
+// acceptsVotes reports whether a ballot submitted at now (Unix seconds) falls
+// inside the election's voting window.
+func (e *Election) acceptsVotes(now int64) bool {
+	if e.Status != ElectionOpen {
+		return false
+	}
+	if e.OpensAt != 0 && now < e.OpensAt {
+		return false
+	}
+	if e.ClosesAt != 0 && now >= e.ClosesAt {
+		return false
+	}
+	return true
+}
+
+// tallyVisible reports whether results may be read at now. Elections that
+// hide their tally only reveal it once voting has ended.
+func (e *Election) tallyVisible(now int64) bool {
+	if !e.HideTally {
+		return true
+	}
+	switch e.Status {
+	case ElectionClosed, ElectionCertified:
+		return true
+	case ElectionOpen:
+		return e.ClosesAt != 0 && now >= e.ClosesAt
+	}
+	return false
+}
+
+// acceptsReveals reports whether a commit-reveal ballot may be revealed at
+// now: voting has ended, the election is not yet certified and the reveal
+// window has not closed.
+func (e *Election) acceptsReveals(now int64) bool {
+	if !e.CommitReveal {
+		return false
+	}
+	if e.RevealClosesAt != 0 && now >= e.RevealClosesAt {
+		return false
+	}
+	switch e.Status {
+	case ElectionClosed:
+		return true
+	case ElectionOpen:
+		return e.ClosesAt != 0 && now >= e.ClosesAt
+	}
+	return false
+}
+
+func txTime(ctx contractapi.TransactionContextInterface) (int64, error) {
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return 0, err
+	}
+	return timestamp.GetSeconds(), nil
+}
+
+func electionKey(ctx contractapi.TransactionContextInterface, id string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(electionObjectType, []string{id})
+}
+
+func putElection(ctx contractapi.TransactionContextInterface, election *Election) error {
+	key, err := electionKey(ctx, election.ID)
+	if err != nil {
+		return err
+	}
+	electionJSON, err := json.Marshal(election)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(key, electionJSON)
+}
+
+// CreateElection creates a draft election with a candidate for each of
+// candidates, an ID that also serves as its name until UpdateCandidate
+// changes it.
+func (pc *VoteSmartContract) CreateElection(ctx contractapi.TransactionContextInterface, id string, title string, ballotType string, limit int, opensAt int64, closesAt int64, hideTally bool, candidates []string) error {
+	if id == "" {
+		return fmt.Errorf("election id must not be empty")
+	}
+	switch ballotType {
+	case "":
+		ballotType = BallotPlurality
+	case BallotPlurality, BallotRanked, BallotApproval, BallotScore:
+	default:
+		return fmt.Errorf("unknown ballot type %s", ballotType)
+	}
+	if limit < 0 {
+		return fmt.Errorf("ballot limit must not be negative")
+	}
+	if ballotType == BallotScore && limit == 0 {
+		return fmt.Errorf("score elections need a maximum score")
+	}
+	if closesAt != 0 && closesAt < opensAt {
+		return fmt.Errorf("election %s closes before it opens", id)
+	}
+	key, err := electionKey(ctx, id)
+	if err != nil {
+		return err
+	}
+	existing, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("election %s already exists", id)
+	}
+	election := Election{
+		ID:         id,
+		Title:      title,
+		OpensAt:    opensAt,
+		ClosesAt:   closesAt,
+		Status:     ElectionDraft,
+		HideTally:  hideTally,
+		BallotType: ballotType,
+		Limit:      limit,
+		Candidates: []string{},
+	}
+	for _, candidateID := range candidates {
+		err = registerCandidate(ctx, &election, &Candidate{ID: candidateID, Name: candidateID})
+		if err != nil {
+			return err
+		}
+	}
+	return putElection(ctx, &election)
+}
+
+// statusEvents names the chaincode event set when an election enters a status.
+var statusEvents = map[string]string{
+	ElectionOpen:   EventElectionOpened,
+	ElectionClosed: EventElectionClosed,
+}
+
+func (pc *VoteSmartContract) transitionElection(ctx contractapi.TransactionContextInterface, id string, from string, to string) error {
+	election, err := pc.GetElection(ctx, id)
+	if err != nil {
+		return err
+	}
+	if election.Status != from {
+		return fmt.Errorf("election %s is %s, expected %s", id, election.Status, from)
+	}
+	election.Status = to
+	err = putElection(ctx, election)
+	if err != nil {
+		return err
+	}
+	if event, ok := statusEvents[to]; ok {
+		return setEvent(ctx, event, &Event{ElectionID: id, Status: to})
+	}
+	return nil
+}
+
+func (pc *VoteSmartContract) OpenElection(ctx contractapi.TransactionContextInterface, id string) error {
+	return pc.transitionElection(ctx, id, ElectionDraft, ElectionOpen)
+}
+
+func (pc *VoteSmartContract) CloseElection(ctx contractapi.TransactionContextInterface, id string) error {
+	return pc.transitionElection(ctx, id, ElectionOpen, ElectionClosed)
+}
+
+func (pc *VoteSmartContract) CertifyElection(ctx contractapi.TransactionContextInterface, id string) error {
+	return pc.transitionElection(ctx, id, ElectionClosed, ElectionCertified)
+}
+
+func (pc *VoteSmartContract) GetElection(ctx contractapi.TransactionContextInterface, id string) (*Election, error) {
+	key, err := electionKey(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	electionJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, err
+	}
+	if electionJSON == nil {
+		return nil, fmt.Errorf("election %s does not exist", id)
+	}
+	var election *Election
+	err = json.Unmarshal(electionJSON, &election)
+	if err != nil {
+		return nil, err
+	}
+	return election, nil
+}
+
+func (pc *VoteSmartContract) ListElections(ctx contractapi.TransactionContextInterface) ([]*Election, error) {
+	electionIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(electionObjectType, []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer electionIterator.Close()
+	var elections []*Election
+	for electionIterator.HasNext() {
+		electionResponse, err := electionIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var election *Election
+		err = json.Unmarshal(electionResponse.Value, &election)
+		if err != nil {
+			return nil, err
+		}
+		elections = append(elections, election)
+	}
+	return elections, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCreateElectionCandidates(t *testing.T) {
+	pc := &VoteSmartContract{}
+	ctx, stub := newTestContext()
+
+	stub.MockTransactionStart("create")
+	err := pc.CreateElection(ctx, "lunch", "Lunch", BallotPlurality, 0, 0, 0, false, []string{"pizza", "tacos"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.MockTransactionEnd("create")
+
+	stub.MockTransactionStart("add")
+	err = pc.AddCandidate(ctx, "lunch", "salad", "Salad", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.MockTransactionEnd("add")
+
+	election, err := pc.GetElection(ctx, "lunch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"pizza", "tacos", "salad"}
+	if !reflect.DeepEqual(election.Candidates, want) {
+		t.Errorf("Candidates = %v, want %v", election.Candidates, want)
+	}
+	candidate, err := pc.GetCandidate(ctx, "lunch", "tacos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if candidate.Name != "tacos" || candidate.ElectionID != "lunch" {
+		t.Errorf("GetCandidate() = %+v, want tacos in lunch", candidate)
+	}
+}
+
+func TestCreateElectionDuplicateCandidate(t *testing.T) {
+	pc := &VoteSmartContract{}
+	ctx, stub := newTestContext()
+
+	stub.MockTransactionStart("create")
+	err := pc.CreateElection(ctx, "lunch", "Lunch", BallotPlurality, 0, 0, 0, false, []string{"pizza", "pizza"})
+	if err == nil {
+		t.Error("CreateElection() with a repeated candidate succeeded")
+	}
+	stub.MockTransactionEnd("create")
+}
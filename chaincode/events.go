@@ -0,0 +1,33 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Chaincode event names. Fabric keeps one event per transaction, so each
+// transaction sets at most one of these.
+const (
+	EventVoteCast       = "VoteCast"
+	EventElectionOpened = "ElectionOpened"
+	EventElectionClosed = "ElectionClosed"
+	EventCandidateAdded = "CandidateAdded"
+)
+
+// Event is the JSON payload of every chaincode event. It never carries ballot
+// contents or voter pseudonyms, since events are readable by every peer on
+// the channel.
+type Event struct {
+	ElectionID  string `json:"electionId"`
+	Status      string `json:"status,omitempty"`
+	CandidateID string `json:"candidateId,omitempty"`
+}
+
+func setEvent(ctx contractapi.TransactionContextInterface, name string, event *Event) error {
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().SetEvent(name, eventJSON)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// HistoryEntry is one committed write to a ledger key. Value is the JSON the
+// transaction wrote and is empty for deletes. Timestamp is in Unix seconds.
+type HistoryEntry struct {
+	TxID      string `json:"txId"`
+	Timestamp int64  `json:"timestamp"`
+	IsDelete  bool   `json:"isDelete"`
+	Value     string `json:"value"`
+}
+
+// keyHistory returns every committed write to key, most recent first. It
+// needs the peer's history database, which is on by default.
+func keyHistory(ctx contractapi.TransactionContextInterface, key string) ([]*HistoryEntry, error) {
+	historyIterator, err := ctx.GetStub().GetHistoryForKey(key)
+	if err != nil {
+		return nil, err
+	}
+	defer historyIterator.Close()
+	history := []*HistoryEntry{}
+	for historyIterator.HasNext() {
+		modification, err := historyIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, &HistoryEntry{
+			TxID:      modification.TxId,
+			Timestamp: modification.Timestamp.GetSeconds(),
+			IsDelete:  modification.IsDelete,
+			Value:     string(modification.Value),
+		})
+	}
+	return history, nil
+}
+
+func (pc *VoteSmartContract) GetElectionHistory(ctx contractapi.TransactionContextInterface, electionID string) ([]*HistoryEntry, error) {
+	key, err := electionKey(ctx, electionID)
+	if err != nil {
+		return nil, err
+	}
+	return keyHistory(ctx, key)
+}
+
+func (pc *VoteSmartContract) GetCandidateHistory(ctx contractapi.TransactionContextInterface, electionID string, candidateID string) ([]*HistoryEntry, error) {
+	key, err := candidateKey(ctx, electionID, candidateID)
+	if err != nil {
+		return nil, err
+	}
+	return keyHistory(ctx, key)
+}
+
+// GetVoteHistory returns the history of a vote's public record. A single
+// entry shows the ballot hash was never overwritten; ballot contents live in
+// the private collection, which keeps no history.
+func (pc *VoteSmartContract) GetVoteHistory(ctx contractapi.TransactionContextInterface, electionID string, voteID string) ([]*HistoryEntry, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(voteObjectType, []string{electionID, voteID})
+	if err != nil {
+		return nil, err
+	}
+	return keyHistory(ctx, key)
+}
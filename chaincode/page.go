@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// maxPageSize caps QueryVotesPaginated so a page always fits in a gRPC
+// response.
+const maxPageSize = 1000
+
+// VotePage is one page of an election's ballots. Bookmark is passed back to
+// fetch the next page and is empty after the last one.
+type VotePage struct {
+	Votes        []*Vote `json:"votes"`
+	Bookmark     string  `json:"bookmark"`
+	FetchedCount int32   `json:"fetchedCount"`
+}
+
+// QueryVotesPaginated returns up to pageSize of the election's ballots
+// starting at bookmark. Private data cannot be paged, so it pages through the
+// public vote records and reads each ballot from ballotCollection. Vote keys
+// are composite, which rules out GetStateByRangeWithPagination. Like
+// QueryAllVotes it must be evaluated on a peer of a collection member.
+func (pc *VoteSmartContract) QueryVotesPaginated(ctx contractapi.TransactionContextInterface, electionID string, pageSize int32, bookmark string) (*VotePage, error) {
+	if pageSize <= 0 || pageSize > maxPageSize {
+		return nil, fmt.Errorf("page size must be between 1 and %d", maxPageSize)
+	}
+	err := pc.assertTallyVisible(ctx, electionID)
+	if err != nil {
+		return nil, err
+	}
+	recordIterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(voteObjectType, []string{electionID}, pageSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+	defer recordIterator.Close()
+	page := &VotePage{
+		Votes:        []*Vote{},
+		Bookmark:     metadata.GetBookmark(),
+		FetchedCount: metadata.GetFetchedRecordsCount(),
+	}
+	for recordIterator.HasNext() {
+		recordResponse, err := recordIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var record Vote
+		err = json.Unmarshal(recordResponse.Value, &record)
+		if err != nil {
+			return nil, err
+		}
+		ballotJSON, err := ctx.GetStub().GetPrivateData(ballotCollection, recordResponse.Key)
+		if err != nil {
+			return nil, err
+		}
+		if ballotJSON == nil {
+			return nil, fmt.Errorf("ballot for vote %s is missing from %s", record.ID, ballotCollection)
+		}
+		var vote *Vote
+		err = json.Unmarshal(ballotJSON, &vote)
+		if err != nil {
+			return nil, err
+		}
+		vote.BallotHash = record.BallotHash
+		page.Votes = append(page.Votes, vote)
+	}
+	if page.FetchedCount < pageSize {
+		page.Bookmark = ""
+	}
+	return page, nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// ballotCollection is the private data collection holding ballot contents. It
+// is declared in collections_config.json, which must be supplied when the
+// chaincode is approved and committed.
+const ballotCollection = "ballotsCollection"
+
+// Transient fields the app sends with ballot transactions so that they never
+// appear in the transaction's arguments.
+const (
+	transientBallot     = "ballot"
+	transientVoter      = "voter"
+	transientSalt       = "salt"
+	transientCommitment = "commitment"
+)
+
+// readTransient returns the JSON ballot, voter pseudonym and salt the app sent
+// in the transient map.
+func readTransient(ctx contractapi.TransactionContextInterface) ([]byte, string, string, error) {
+	transient, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return nil, "", "", err
+	}
+	ballotJSON, ok := transient[transientBallot]
+	if !ok {
+		return nil, "", "", fmt.Errorf("ballot must be passed in the transient field %s", transientBallot)
+	}
+	salt := string(transient[transientSalt])
+	if salt == "" {
+		return nil, "", "", fmt.Errorf("ballot salt must be passed in the transient field %s", transientSalt)
+	}
+	return ballotJSON, string(transient[transientVoter]), salt, nil
+}
+
+// sealBallot returns the private ballot JSON and the public record that stands
+// in for it on the channel ledger, which carries only the ballot's hash. The
+// salt inside the private ballot keeps the hash from being matched against
+// every possible ballot.
+func sealBallot(vote *Vote) ([]byte, *Vote, error) {
+	ballot := *vote
+	ballot.BallotHash = ""
+	ballotJSON, err := json.Marshal(ballot)
+	if err != nil {
+		return nil, nil, err
+	}
+	sum := sha256.Sum256(ballotJSON)
+	record := &Vote{
+		ID:         vote.ID,
+		ElectionID: vote.ElectionID,
+		CastAt:     vote.CastAt,
+		BallotHash: hex.EncodeToString(sum[:]),
+	}
+	return ballotJSON, record, nil
+}
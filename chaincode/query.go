@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// voteQuery is a rich query over votes: a CouchDB selector, the index it is
+// written for, and the same condition as a Go predicate for peers whose state
+// database is LevelDB.
+type voteQuery struct {
+	selector map[string]interface{}
+	index    []string
+	match    func(vote *Vote) bool
+}
+
+// Indexes shipped under META-INF/statedb/couchdb, named as design document
+// and index for use_index. Each selector runVoteQuery sends names every field
+// of the index it uses. CouchDB cannot index array elements or map keys, so
+// ranked, approval and score queries use the election index and filter that
+// election's ballots.
+var (
+	indexBallotCandidate = []string{"_design/indexBallotCandidateDoc", "indexBallotCandidate"}
+	indexBallotElection  = []string{"_design/indexBallotElectionDoc", "indexBallotElection"}
+	indexVoteCastAt      = []string{"_design/indexVoteCastAtDoc", "indexVoteCastAt"}
+)
+
+// unsupportedQuery reports whether err is the peer refusing a rich query
+// because its state database is LevelDB.
+func unsupportedQuery(err error) bool {
+	return strings.Contains(err.Error(), "not supported for leveldb")
+}
+
+// runVoteQuery runs query against the election's public vote records, or its
+// ballots in ballotCollection when private is set. On LevelDB it scans the
+// election's votes by key and filters them with query.match instead.
+func runVoteQuery(ctx contractapi.TransactionContextInterface, electionID string, query voteQuery, private bool) ([]*Vote, error) {
+	query.selector["electionId"] = electionID
+	queryJSON, err := json.Marshal(map[string]interface{}{"selector": query.selector, "use_index": query.index})
+	if err != nil {
+		return nil, err
+	}
+	var iterator shim.StateQueryIteratorInterface
+	if private {
+		iterator, err = ctx.GetStub().GetPrivateDataQueryResult(ballotCollection, string(queryJSON))
+	} else {
+		iterator, err = ctx.GetStub().GetQueryResult(string(queryJSON))
+	}
+	filter := false
+	if err != nil && unsupportedQuery(err) {
+		filter = true
+		if private {
+			iterator, err = ctx.GetStub().GetPrivateDataByPartialCompositeKey(ballotCollection, voteObjectType, []string{electionID})
+		} else {
+			iterator, err = ctx.GetStub().GetStateByPartialCompositeKey(voteObjectType, []string{electionID})
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer iterator.Close()
+	votes := []*Vote{}
+	for iterator.HasNext() {
+		response, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var vote *Vote
+		err = json.Unmarshal(response.Value, &vote)
+		if err != nil {
+			return nil, err
+		}
+		if filter && !query.match(vote) {
+			continue
+		}
+		votes = append(votes, vote)
+	}
+	return votes, nil
+}
+
+// QueryVotesByCandidate returns the election's ballots that name the
+// candidate: chose, ranked, approved or scored them, depending on the
+// election's ballot type. It reads ballotCollection, so it must be evaluated
+// on a peer of a collection member.
+func (pc *VoteSmartContract) QueryVotesByCandidate(ctx contractapi.TransactionContextInterface, electionID string, candidateID string) ([]*Vote, error) {
+	err := pc.assertTallyVisible(ctx, electionID)
+	if err != nil {
+		return nil, err
+	}
+	election, err := pc.GetElection(ctx, electionID)
+	if err != nil {
+		return nil, err
+	}
+	return runVoteQuery(ctx, electionID, candidateQuery(election.ballotType(), candidateID), true)
+}
+
+// candidateQuery selects the ballots of ballotType that name candidateID.
+func candidateQuery(ballotType string, candidateID string) voteQuery {
+	named := map[string]interface{}{"$elemMatch": map[string]interface{}{"$eq": candidateID}}
+	contains := func(candidates []string) bool {
+		for _, candidate := range candidates {
+			if candidate == candidateID {
+				return true
+			}
+		}
+		return false
+	}
+	switch ballotType {
+	case BallotRanked:
+		return voteQuery{
+			selector: map[string]interface{}{"rankings": named},
+			index:    indexBallotElection,
+			match:    func(vote *Vote) bool { return contains(vote.Rankings) },
+		}
+	case BallotApproval:
+		return voteQuery{
+			selector: map[string]interface{}{"approvals": named},
+			index:    indexBallotElection,
+			match:    func(vote *Vote) bool { return contains(vote.Approvals) },
+		}
+	case BallotScore:
+		return voteQuery{
+			selector: map[string]interface{}{"scores." + candidateID: map[string]interface{}{"$exists": true}},
+			index:    indexBallotElection,
+			match: func(vote *Vote) bool {
+				_, ok := vote.Scores[candidateID]
+				return ok
+			},
+		}
+	}
+	return voteQuery{
+		selector: map[string]interface{}{"candidate": candidateID},
+		index:    indexBallotCandidate,
+		match:    func(vote *Vote) bool { return vote.Candidate == candidateID },
+	}
+}
+
+// QueryVotesByTime returns the public records of votes recorded from (Unix
+// seconds, inclusive) until to (exclusive). Records carry only the ballot
+// hash, so it is open to any peer and while the tally is hidden.
+func (pc *VoteSmartContract) QueryVotesByTime(ctx contractapi.TransactionContextInterface, electionID string, from int64, to int64) ([]*Vote, error) {
+	_, err := pc.GetElection(ctx, electionID)
+	if err != nil {
+		return nil, err
+	}
+	return runVoteQuery(ctx, electionID, voteQuery{
+		selector: map[string]interface{}{
+			"ballotHash": map[string]interface{}{"$exists": true},
+			"castAt":     map[string]interface{}{"$gte": from, "$lt": to},
+		},
+		index: indexVoteCastAt,
+		match: func(vote *Vote) bool {
+			return vote.CastAt >= from && vote.CastAt < to
+		},
+	}, false)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCandidateQuery(t *testing.T) {
+	tests := []struct {
+		ballotType string
+		index      []string
+		named      *Vote
+		other      *Vote
+	}{
+		{BallotPlurality, indexBallotCandidate, &Vote{Candidate: "a"}, &Vote{Candidate: "b"}},
+		{BallotRanked, indexBallotElection, &Vote{Rankings: []string{"b", "a"}}, &Vote{Rankings: []string{"b"}}},
+		{BallotApproval, indexBallotElection, &Vote{Approvals: []string{"a"}}, &Vote{Approvals: []string{"b"}}},
+		{BallotScore, indexBallotElection, &Vote{Scores: map[string]int{"a": 0}}, &Vote{Scores: map[string]int{"b": 5}}},
+	}
+	for _, test := range tests {
+		t.Run(test.ballotType, func(t *testing.T) {
+			query := candidateQuery(test.ballotType, "a")
+			if _, ok := query.selector["$or"]; ok {
+				t.Error("selector uses $or, which no index can serve")
+			}
+			if !reflect.DeepEqual(query.index, test.index) {
+				t.Errorf("index = %v, want %v", query.index, test.index)
+			}
+			if !query.match(test.named) {
+				t.Errorf("match(%+v) = false, want true", test.named)
+			}
+			if query.match(test.other) {
+				t.Errorf("match(%+v) = true, want false", test.other)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// RankedRound is one round of an instant-runoff count: the votes each
+// remaining candidate held, how many ballots had no remaining preference, and
+// who was eliminated at the end of the round.
+type RankedRound struct {
+	Round      int            `json:"round"`
+	Counts     map[string]int `json:"counts"`
+	Exhausted  int            `json:"exhausted"`
+	Eliminated []string       `json:"eliminated,omitempty"`
+}
+
+// RankedResult lists every round of the count. Winner is empty when the final
+// candidates are tied or no ballot ranks a remaining candidate.
+type RankedResult struct {
+	Rounds []RankedRound `json:"rounds"`
+	Winner string        `json:"winner,omitempty"`
+}
+
+// AddRankedVote records a transient ballot listing candidate IDs, most
+// preferred first.
+func (pc *VoteSmartContract) AddRankedVote(ctx contractapi.TransactionContextInterface, electionID string) (*Receipt, error) {
+	return pc.addBallot(ctx, electionID, BallotRanked)
+}
+
+func (pc *VoteSmartContract) rankedBallot(ctx contractapi.TransactionContextInterface, election *Election, ballotJSON []byte) (*Vote, error) {
+	var rankings []string
+	err := json.Unmarshal(ballotJSON, &rankings)
+	if err != nil {
+		return nil, err
+	}
+	if len(rankings) == 0 {
+		return nil, fmt.Errorf("ranked ballot must rank at least one candidate")
+	}
+	seen := map[string]bool{}
+	for _, candidate := range rankings {
+		if seen[candidate] {
+			return nil, fmt.Errorf("candidate %s is ranked more than once", candidate)
+		}
+		seen[candidate] = true
+		err = pc.assertCandidate(ctx, election.ID, candidate)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &Vote{Rankings: rankings}, nil
+}
+
+// TallyRanked runs an instant-runoff count over the election's ranked ballots.
+func (pc *VoteSmartContract) TallyRanked(ctx contractapi.TransactionContextInterface, electionID string) (*RankedResult, error) {
+	votes, err := pc.QueryAllVotes(ctx, electionID)
+	if err != nil {
+		return nil, err
+	}
+	candidates, err := pc.ListCandidates(ctx, electionID)
+	if err != nil {
+		return nil, err
+	}
+	var standing []string
+	for _, candidate := range candidates {
+		if !candidate.Withdrawn {
+			standing = append(standing, candidate.ID)
+		}
+	}
+	return instantRunoff(votes, standing), nil
+}
+
+// instantRunoff counts rounds until a candidate holds a majority of the
+// non-exhausted ballots. Each round a ballot counts for its highest-ranked
+// remaining candidate and every candidate tied for the fewest votes is
+// eliminated. Eliminating all tied candidates keeps the result independent of
+// map iteration order, which every endorsing peer must agree on.
+func instantRunoff(votes []*Vote, candidates []string) *RankedResult {
+	remaining := map[string]bool{}
+	for _, candidate := range candidates {
+		remaining[candidate] = true
+	}
+
+	result := &RankedResult{}
+	for len(remaining) > 0 {
+		round := RankedRound{
+			Round:  len(result.Rounds) + 1,
+			Counts: map[string]int{},
+		}
+		for candidate := range remaining {
+			round.Counts[candidate] = 0
+		}
+		for _, vote := range votes {
+			counted := false
+			for _, candidate := range vote.Rankings {
+				if remaining[candidate] {
+					round.Counts[candidate]++
+					counted = true
+					break
+				}
+			}
+			if !counted {
+				round.Exhausted++
+			}
+		}
+
+		active := len(votes) - round.Exhausted
+		lowest := -1
+		for candidate, count := range round.Counts {
+			if active > 0 && count*2 > active {
+				result.Winner = candidate
+			}
+			if lowest < 0 || count < lowest {
+				lowest = count
+			}
+		}
+
+		var eliminated []string
+		for candidate, count := range round.Counts {
+			if count == lowest {
+				eliminated = append(eliminated, candidate)
+			}
+		}
+		if result.Winner != "" || active == 0 || len(eliminated) == len(remaining) {
+			result.Rounds = append(result.Rounds, round)
+			break
+		}
+
+		sort.Strings(eliminated)
+		round.Eliminated = eliminated
+		result.Rounds = append(result.Rounds, round)
+		for _, candidate := range eliminated {
+			delete(remaining, candidate)
+		}
+	}
+	return result
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func rankedVotes(rankings ...[]string) []*Vote {
+	votes := []*Vote{}
+	for _, ranking := range rankings {
+		votes = append(votes, &Vote{Rankings: ranking})
+	}
+	return votes
+}
+
+func TestInstantRunoff(t *testing.T) {
+	tests := []struct {
+		name       string
+		candidates []string
+		votes      []*Vote
+		want       *RankedResult
+	}{
+		{
+			name:       "majority in round 1",
+			candidates: []string{"a", "b", "c"},
+			votes:      rankedVotes([]string{"a"}, []string{"a", "b"}, []string{"b"}),
+			want: &RankedResult{
+				Rounds: []RankedRound{
+					{Round: 1, Counts: map[string]int{"a": 2, "b": 1, "c": 0}},
+				},
+				Winner: "a",
+			},
+		},
+		{
+			name:       "transfer over rounds",
+			candidates: []string{"a", "b", "c"},
+			votes: rankedVotes(
+				[]string{"a"}, []string{"a"},
+				[]string{"b"}, []string{"b"},
+				[]string{"c", "b"},
+			),
+			want: &RankedResult{
+				Rounds: []RankedRound{
+					{Round: 1, Counts: map[string]int{"a": 2, "b": 2, "c": 1}, Eliminated: []string{"c"}},
+					{Round: 2, Counts: map[string]int{"a": 2, "b": 3}},
+				},
+				Winner: "b",
+			},
+		},
+		{
+			name:       "tie for last eliminates every tied candidate",
+			candidates: []string{"a", "b", "c", "d"},
+			votes: rankedVotes(
+				[]string{"a"}, []string{"a"}, []string{"a"},
+				[]string{"b", "a"},
+				[]string{"c", "b"},
+				[]string{"d", "b"},
+			),
+			want: &RankedResult{
+				Rounds: []RankedRound{
+					{Round: 1, Counts: map[string]int{"a": 3, "b": 1, "c": 1, "d": 1}, Eliminated: []string{"b", "c", "d"}},
+					{Round: 2, Counts: map[string]int{"a": 4}, Exhausted: 2},
+				},
+				Winner: "a",
+			},
+		},
+		{
+			name:       "all tied in the final round",
+			candidates: []string{"a", "b", "c", "d"},
+			votes: rankedVotes(
+				[]string{"a"}, []string{"a"},
+				[]string{"b"}, []string{"b"},
+				[]string{"c"},
+				[]string{"d"},
+			),
+			want: &RankedResult{
+				Rounds: []RankedRound{
+					{Round: 1, Counts: map[string]int{"a": 2, "b": 2, "c": 1, "d": 1}, Eliminated: []string{"c", "d"}},
+					{Round: 2, Counts: map[string]int{"a": 2, "b": 2}, Exhausted: 2},
+				},
+			},
+		},
+		{
+			name:       "ballots ranking only withdrawn candidates are exhausted",
+			candidates: []string{"a", "b"},
+			votes: rankedVotes(
+				[]string{"w"},
+				[]string{"w", "a"},
+				[]string{"a"},
+				[]string{"b"},
+			),
+			want: &RankedResult{
+				Rounds: []RankedRound{
+					{Round: 1, Counts: map[string]int{"a": 2, "b": 1}, Exhausted: 1},
+				},
+				Winner: "a",
+			},
+		},
+		{
+			name:       "every ballot exhausted",
+			candidates: []string{"a", "b"},
+			votes:      rankedVotes([]string{"w"}, []string{"w", "x"}),
+			want: &RankedResult{
+				Rounds: []RankedRound{
+					{Round: 1, Counts: map[string]int{"a": 0, "b": 0}, Exhausted: 2},
+				},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := instantRunoff(test.votes, test.candidates)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("instantRunoff() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
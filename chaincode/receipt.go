@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Receipt is returned to the voter when their ballot is recorded. ElectionID
+// and VoteID make up the vote's ledger key and BallotHash is the hash in its
+// public record, so the receipt proves inclusion without showing the ballot.
+type Receipt struct {
+	TxID       string `json:"txId"`
+	ElectionID string `json:"electionId"`
+	VoteID     string `json:"voteId"`
+	BallotHash string `json:"ballotHash"`
+}
+
+// VerifyReceipt reports whether the ledger holds a vote matching the receipt:
+// its public record carries ballotHash and the ballot stored in
+// ballotCollection hashes to the same value. It reads only hashes, so any peer
+// can evaluate it and it reveals nothing about other ballots.
+func (pc *VoteSmartContract) VerifyReceipt(ctx contractapi.TransactionContextInterface, electionID string, voteID string, ballotHash string) (bool, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(voteObjectType, []string{electionID, voteID})
+	if err != nil {
+		return false, err
+	}
+	recordJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return false, err
+	}
+	if recordJSON == nil {
+		return false, nil
+	}
+	var record Vote
+	err = json.Unmarshal(recordJSON, &record)
+	if err != nil {
+		return false, err
+	}
+	if record.BallotHash != ballotHash {
+		return false, nil
+	}
+	privateHash, err := ctx.GetStub().GetPrivateDataHash(ballotCollection, key)
+	if err != nil {
+		return false, err
+	}
+	return hex.EncodeToString(privateHash) == ballotHash, nil
+}
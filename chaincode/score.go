@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// AddScoreVote records a transient ballot rating candidates from 0 to the
+// election's limit. Candidates left off the ballot are not scored rather than
+// scored 0.
+func (pc *VoteSmartContract) AddScoreVote(ctx contractapi.TransactionContextInterface, electionID string) (*Receipt, error) {
+	return pc.addBallot(ctx, electionID, BallotScore)
+}
+
+func (pc *VoteSmartContract) scoreBallot(ctx contractapi.TransactionContextInterface, election *Election, ballotJSON []byte) (*Vote, error) {
+	var scores map[string]int
+	err := json.Unmarshal(ballotJSON, &scores)
+	if err != nil {
+		return nil, err
+	}
+	if len(scores) == 0 {
+		return nil, fmt.Errorf("score ballot must score at least one candidate")
+	}
+	candidates := []string{}
+	for candidate := range scores {
+		candidates = append(candidates, candidate)
+	}
+	sort.Strings(candidates)
+	for _, candidate := range candidates {
+		score := scores[candidate]
+		if score < 0 || score > election.Limit {
+			return nil, fmt.Errorf("score for candidate %s must be between 0 and %d", candidate, election.Limit)
+		}
+		err = pc.assertCandidate(ctx, election.ID, candidate)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &Vote{Scores: scores}, nil
+}
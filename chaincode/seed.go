@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Fixture is the seed data InitLedger loads, supplied by the caller as JSON so
+// that demo data lives with the app rather than in the chaincode.
+type Fixture struct {
+	Elections  []Election  `json:"elections"`
+	Candidates []Candidate `json:"candidates"`
+	Votes      []Vote      `json:"votes"`
+}
+
+// InitLedger seeds an empty ledger from fixtureJSON. It refuses to run once any
+// election exists so that it can never overwrite real results.
+func (pc *VoteSmartContract) InitLedger(ctx contractapi.TransactionContextInterface, fixtureJSON string) error {
+	electionIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(electionObjectType, []string{})
+	if err != nil {
+		return err
+	}
+	initialized := electionIterator.HasNext()
+	electionIterator.Close()
+	if initialized {
+		return fmt.Errorf("ledger already contains elections, refusing to seed")
+	}
+
+	var fixture Fixture
+	err = json.Unmarshal([]byte(fixtureJSON), &fixture)
+	if err != nil {
+		return err
+	}
+
+	candidateIDs := map[string][]string{}
+	for _, candidate := range fixture.Candidates {
+		candidateIDs[candidate.ElectionID] = append(candidateIDs[candidate.ElectionID], candidate.ID)
+	}
+	for _, election := range fixture.Elections {
+		election.Candidates = candidateIDs[election.ID]
+		if election.Candidates == nil {
+			election.Candidates = []string{}
+		}
+		err = putElection(ctx, &election)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, candidate := range fixture.Candidates {
+		err = putCandidate(ctx, &candidate)
+		if err != nil {
+			return err
+		}
+	}
+
+	tallies := map[string]*counters{}
+	for _, vote := range fixture.Votes {
+		_, err = putVote(ctx, &vote)
+		if err != nil {
+			return err
+		}
+		if tallies[vote.ElectionID] == nil {
+			tallies[vote.ElectionID] = newCounters()
+		}
+		tallies[vote.ElectionID].count(&vote)
+	}
+
+	// The fixture's ballots are public in InitLedger's arguments anyway, so
+	// the transaction ID serves as the tally salt.
+	for electionID, c := range tallies {
+		err = putTallyDelta(ctx, electionID, c, ctx.GetStub().GetTxID())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
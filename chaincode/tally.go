@@ -0,0 +1,322 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+const (
+	tallyDeltaObjectType = "tallydelta"
+	tallyBaseObjectType  = "tallybase"
+)
+
+// counters are the running totals behind TallyVotes. Every recorded vote
+// writes its change as delta keys of its own, named by transaction ID, so
+// concurrent votes never write the same key and cannot fail MVCC validation
+// against each other. Only the ballot count is written to the channel ledger;
+// the candidate counts go under the same key in ballotCollection, salted like
+// the ballot so the collection's public hash of the delta cannot be matched
+// against every possible choice. Reading the tally sums the election's base
+// and deltas; CompactTally folds the deltas into the base.
+type counters struct {
+	Ballots int            `json:"ballots"`
+	Counts  map[string]int `json:"counts,omitempty"`
+	Totals  map[string]int `json:"totals,omitempty"`
+	Salt    string         `json:"salt,omitempty"`
+}
+
+func newCounters() *counters {
+	return &counters{
+		Counts: map[string]int{},
+		Totals: map[string]int{},
+	}
+}
+
+// count adds one ballot. Ranked ballots count their first preference.
+func (c *counters) count(vote *Vote) {
+	c.Ballots++
+	switch {
+	case len(vote.Rankings) > 0:
+		c.Counts[vote.Rankings[0]]++
+	case len(vote.Approvals) > 0:
+		for _, candidate := range vote.Approvals {
+			c.Counts[candidate]++
+		}
+	case len(vote.Scores) > 0:
+		for candidate, score := range vote.Scores {
+			c.Counts[candidate]++
+			c.Totals[candidate] += score
+		}
+	default:
+		c.Counts[vote.Candidate]++
+	}
+}
+
+func (c *counters) add(other *counters) {
+	c.Ballots += other.Ballots
+	for candidate, count := range other.Counts {
+		c.Counts[candidate] += count
+	}
+	for candidate, total := range other.Totals {
+		c.Totals[candidate] += total
+	}
+}
+
+// addJSON adds the counters encoded in countersJSON, if any.
+func (c *counters) addJSON(countersJSON []byte) error {
+	if countersJSON == nil {
+		return nil
+	}
+	other := newCounters()
+	err := json.Unmarshal(countersJSON, other)
+	if err != nil {
+		return err
+	}
+	c.add(other)
+	return nil
+}
+
+// putCounters writes the ballot count of c to the channel ledger and its
+// candidate counts, with salt, to ballotCollection, both under key.
+func putCounters(ctx contractapi.TransactionContextInterface, key string, c *counters, salt string) error {
+	publicJSON, err := json.Marshal(&counters{Ballots: c.Ballots})
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().PutState(key, publicJSON)
+	if err != nil {
+		return err
+	}
+	privateJSON, err := json.Marshal(&counters{Counts: c.Counts, Totals: c.Totals, Salt: salt})
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutPrivateData(ballotCollection, key, privateJSON)
+}
+
+// putTallyDelta records c as this transaction's change to the election's
+// tally, salting the private half with salt.
+func putTallyDelta(ctx contractapi.TransactionContextInterface, electionID string, c *counters, salt string) error {
+	key, err := ctx.GetStub().CreateCompositeKey(tallyDeltaObjectType, []string{electionID, ctx.GetStub().GetTxID()})
+	if err != nil {
+		return err
+	}
+	return putCounters(ctx, key, c, salt)
+}
+
+func tallyBaseKey(ctx contractapi.TransactionContextInterface, electionID string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(tallyBaseObjectType, []string{electionID})
+}
+
+// addCounters adds both halves of the counters stored under key. The private
+// half is read by key: Fabric refuses writes in a transaction that has run a
+// range query over private data, and CompactTally must write.
+func (c *counters) addCounters(ctx contractapi.TransactionContextInterface, key string, publicJSON []byte) error {
+	err := c.addJSON(publicJSON)
+	if err != nil {
+		return err
+	}
+	privateJSON, err := ctx.GetStub().GetPrivateData(ballotCollection, key)
+	if err != nil {
+		return err
+	}
+	return c.addJSON(privateJSON)
+}
+
+// sumCounters adds up the election's compacted base and outstanding deltas and
+// returns the keys of the deltas it read. It finds the deltas through their
+// public halves, so it costs one range query plus a private read per delta,
+// and must run on a peer of a collection member.
+func sumCounters(ctx contractapi.TransactionContextInterface, electionID string) (*counters, []string, error) {
+	total := newCounters()
+	baseKey, err := tallyBaseKey(ctx, electionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	baseJSON, err := ctx.GetStub().GetState(baseKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = total.addCounters(ctx, baseKey, baseJSON)
+	if err != nil {
+		return nil, nil, err
+	}
+	deltaIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(tallyDeltaObjectType, []string{electionID})
+	if err != nil {
+		return nil, nil, err
+	}
+	defer deltaIterator.Close()
+	deltaKeys := []string{}
+	for deltaIterator.HasNext() {
+		deltaResponse, err := deltaIterator.Next()
+		if err != nil {
+			return nil, nil, err
+		}
+		err = total.addCounters(ctx, deltaResponse.Key, deltaResponse.Value)
+		if err != nil {
+			return nil, nil, err
+		}
+		deltaKeys = append(deltaKeys, deltaResponse.Key)
+	}
+	return total, deltaKeys, nil
+}
+
+// readBallotCount sums the public halves of the election's base and deltas,
+// so unlike readCounters it can run on any peer. Its cost grows with the votes
+// recorded since the last CompactTally.
+func readBallotCount(ctx contractapi.TransactionContextInterface, electionID string) (int, error) {
+	total := newCounters()
+	baseKey, err := tallyBaseKey(ctx, electionID)
+	if err != nil {
+		return 0, err
+	}
+	baseJSON, err := ctx.GetStub().GetState(baseKey)
+	if err != nil {
+		return 0, err
+	}
+	err = total.addJSON(baseJSON)
+	if err != nil {
+		return 0, err
+	}
+	deltaIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(tallyDeltaObjectType, []string{electionID})
+	if err != nil {
+		return 0, err
+	}
+	defer deltaIterator.Close()
+	for deltaIterator.HasNext() {
+		deltaResponse, err := deltaIterator.Next()
+		if err != nil {
+			return 0, err
+		}
+		err = total.addJSON(deltaResponse.Value)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return total.Ballots, nil
+}
+
+// readCounters sums the election's compacted base and outstanding deltas, the
+// candidate counts coming from ballotCollection. It range-reads the deltas, so
+// transactions that write votes must not call it.
+func readCounters(ctx contractapi.TransactionContextInterface, electionID string) (*counters, error) {
+	total, _, err := sumCounters(ctx, electionID)
+	return total, err
+}
+
+// CompactTally folds the election's outstanding tally deltas into its base
+// counters so reading the tally stays cheap. The private base is salted with
+// the transient field salt. Votes recorded while it runs invalidate it rather
+// than the votes, so it is safe to retry at any time.
+func (pc *VoteSmartContract) CompactTally(ctx contractapi.TransactionContextInterface, electionID string) error {
+	_, err := pc.GetElection(ctx, electionID)
+	if err != nil {
+		return err
+	}
+	transient, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return err
+	}
+	salt := string(transient[transientSalt])
+	if salt == "" {
+		return fmt.Errorf("tally salt must be passed in the transient field %s", transientSalt)
+	}
+	total, deltaKeys, err := sumCounters(ctx, electionID)
+	if err != nil {
+		return err
+	}
+	for _, key := range deltaKeys {
+		err = ctx.GetStub().DelState(key)
+		if err != nil {
+			return err
+		}
+		err = ctx.GetStub().DelPrivateData(ballotCollection, key)
+		if err != nil {
+			return err
+		}
+	}
+	baseKey, err := tallyBaseKey(ctx, electionID)
+	if err != nil {
+		return err
+	}
+	return putCounters(ctx, baseKey, total, salt)
+}
+
+// TallyCheck compares the tally counters against a recount of the raw
+// ballots. BallotDrift, Drift and TotalDrift hold the recount minus the
+// counters, listing only candidates that differ.
+type TallyCheck struct {
+	Consistent  bool           `json:"consistent"`
+	Counters    *Tally         `json:"counters"`
+	Recount     *Tally         `json:"recount"`
+	BallotDrift int            `json:"ballotDrift"`
+	Drift       map[string]int `json:"drift,omitempty"`
+	TotalDrift  map[string]int `json:"totalDrift,omitempty"`
+}
+
+// CheckTally recounts the election's ballots from ballotCollection and
+// reports any drift from the counters TallyVotes reads. Like QueryAllVotes it
+// must be evaluated on a peer of a collection member.
+func (pc *VoteSmartContract) CheckTally(ctx contractapi.TransactionContextInterface, electionID string) (*TallyCheck, error) {
+	election, err := pc.GetElection(ctx, electionID)
+	if err != nil {
+		return nil, err
+	}
+	votes, err := pc.QueryAllVotes(ctx, electionID)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := readCounters(ctx, electionID)
+	if err != nil {
+		return nil, err
+	}
+	recount := newCounters()
+	for _, vote := range votes {
+		recount.count(vote)
+	}
+
+	check := &TallyCheck{
+		Counters:    election.tally(stored),
+		Recount:     election.tally(recount),
+		BallotDrift: recount.Ballots - stored.Ballots,
+		Drift:       drift(recount.Counts, stored.Counts),
+		TotalDrift:  drift(recount.Totals, stored.Totals),
+	}
+	check.Consistent = check.BallotDrift == 0 && len(check.Drift) == 0 && len(check.TotalDrift) == 0
+	return check, nil
+}
+
+// drift returns want minus got for every key where they differ.
+func drift(want map[string]int, got map[string]int) map[string]int {
+	diff := map[string]int{}
+	for key, value := range want {
+		if value != got[key] {
+			diff[key] = value - got[key]
+		}
+	}
+	for key, value := range got {
+		if _, ok := want[key]; !ok && value != 0 {
+			diff[key] = -value
+		}
+	}
+	return diff
+}
+
+// tally shapes counters into the election's Tally.
+func (e *Election) tally(c *counters) *Tally {
+	tally := &Tally{
+		BallotType: e.ballotType(),
+		Ballots:    c.Ballots,
+		Counts:     c.Counts,
+	}
+	if tally.BallotType == BallotScore {
+		tally.Totals = c.Totals
+		tally.Means = map[string]float64{}
+		for candidate, total := range c.Totals {
+			tally.Means[candidate] = float64(total) / float64(c.Counts[candidate])
+		}
+	}
+	return tally
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// pvtStub fills in the private data calls MockStub leaves unimplemented and
+// enforces the peer's rule that a transaction which has range-queried private
+// data may not write.
+type pvtStub struct {
+	*shimtest.MockStub
+	queriedPvt bool
+}
+
+var errPvtQueryWrite = errors.New("transaction has already performed queries on pvt data, writes are not allowed")
+
+func (s *pvtStub) MockTransactionStart(txID string) {
+	s.queriedPvt = false
+	s.MockStub.MockTransactionStart(txID)
+}
+
+func (s *pvtStub) GetPrivateDataByPartialCompositeKey(collection, objectType string, attributes []string) (shim.StateQueryIteratorInterface, error) {
+	s.queriedPvt = true
+	return s.MockStub.GetPrivateDataByPartialCompositeKey(collection, objectType, attributes)
+}
+
+func (s *pvtStub) PutState(key string, value []byte) error {
+	if s.queriedPvt {
+		return errPvtQueryWrite
+	}
+	return s.MockStub.PutState(key, value)
+}
+
+func (s *pvtStub) DelState(key string) error {
+	if s.queriedPvt {
+		return errPvtQueryWrite
+	}
+	return s.MockStub.DelState(key)
+}
+
+func (s *pvtStub) PutPrivateData(collection, key string, value []byte) error {
+	if s.queriedPvt {
+		return errPvtQueryWrite
+	}
+	return s.MockStub.PutPrivateData(collection, key, value)
+}
+
+func (s *pvtStub) DelPrivateData(collection, key string) error {
+	if s.queriedPvt {
+		return errPvtQueryWrite
+	}
+	delete(s.PvtState[collection], key)
+	return nil
+}
+
+func newTestContext() (*contractapi.TransactionContext, *pvtStub) {
+	stub := &pvtStub{MockStub: shimtest.NewMockStub("vote", nil)}
+	ctx := &contractapi.TransactionContext{}
+	ctx.SetStub(stub)
+	return ctx, stub
+}
+
+func TestCompactTally(t *testing.T) {
+	pc := &VoteSmartContract{}
+	ctx, stub := newTestContext()
+
+	stub.MockTransactionStart("create")
+	err := pc.CreateElection(ctx, "lunch", "Lunch", BallotPlurality, 0, 0, 0, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.MockTransactionEnd("create")
+
+	for txID, candidate := range map[string]string{"vote1": "pizza", "vote2": "pizza", "vote3": "tacos"} {
+		stub.MockTransactionStart(txID)
+		_, err = pc.recordVote(ctx, &Vote{ID: txID, ElectionID: "lunch", Candidate: candidate, Salt: "salt-" + txID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		stub.MockTransactionEnd(txID)
+	}
+
+	stub.MockTransactionStart("compact")
+	err = stub.SetTransient(map[string][]byte{transientSalt: []byte("compact-salt")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = pc.CompactTally(ctx, "lunch")
+	if err != nil {
+		t.Fatalf("CompactTally() error = %v", err)
+	}
+	stub.MockTransactionEnd("compact")
+
+	deltaIterator, err := stub.GetStateByPartialCompositeKey(tallyDeltaObjectType, []string{"lunch"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deltaIterator.HasNext() {
+		t.Error("public tally deltas remain after CompactTally")
+	}
+	deltaIterator.Close()
+	for key := range stub.PvtState[ballotCollection] {
+		objectType, _, err := stub.SplitCompositeKey(key)
+		if err == nil && objectType == tallyDeltaObjectType {
+			t.Errorf("private tally delta %q remains after CompactTally", key)
+		}
+	}
+
+	stub.MockTransactionStart("vote-after")
+	_, err = pc.recordVote(ctx, &Vote{ID: "vote-after", ElectionID: "lunch", Candidate: "tacos", Salt: "salt-after"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.MockTransactionEnd("vote-after")
+
+	stub.MockTransactionStart("read")
+	got, err := readCounters(ctx, "lunch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &counters{Ballots: 4, Counts: map[string]int{"pizza": 2, "tacos": 2}, Totals: map[string]int{}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readCounters() = %+v, want %+v", got, want)
+	}
+	ballots, err := pc.CountVotes(ctx, "lunch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ballots != 4 {
+		t.Errorf("CountVotes() = %d, want 4", ballots)
+	}
+	stub.MockTransactionEnd("read")
+}
+
+func TestCompactTallyNeedsSalt(t *testing.T) {
+	pc := &VoteSmartContract{}
+	ctx, stub := newTestContext()
+
+	stub.MockTransactionStart("create")
+	err := pc.CreateElection(ctx, "lunch", "Lunch", BallotPlurality, 0, 0, 0, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.MockTransactionEnd("create")
+
+	stub.MockTransactionStart("compact")
+	err = pc.CompactTally(ctx, "lunch")
+	if err == nil {
+		t.Error("CompactTally() without a salt succeeded")
+	}
+	stub.MockTransactionEnd("compact")
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
-	"strconv"
+	"fmt"
 
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
@@ -11,103 +13,302 @@ type VoteSmartContract struct {
 	contractapi.Contract
 }
 
+const (
+	voteObjectType  = "vote"
+	votedObjectType = "voted"
+)
+
+// AlreadyVotedError is returned by AddVote when the voter already holds a
+// ballot in the election. The app matches on its message prefix.
+type AlreadyVotedError struct {
+	ElectionID string
+}
+
+func (e *AlreadyVotedError) Error() string {
+	return fmt.Sprintf("already voted in election %s", e.ElectionID)
+}
+
+// Vote holds a single ballot. Which field is set depends on the election's
+// ballot type: Candidate for plurality, Rankings (most preferred first) for
+// ranked, Approvals for approval and Scores for score ballots. The ballot and
+// its salt live in ballotCollection; the channel ledger only records ID,
+// ElectionID, CastAt and BallotHash. CastAt is the Unix second the ballot was
+// recorded.
 type Vote struct {
-	ID        string `json:"id"`
-	Candidate string `json:"candidate"`
+	ID         string         `json:"id"`
+	ElectionID string         `json:"electionId"`
+	Candidate  string         `json:"candidate,omitempty"`
+	Rankings   []string       `json:"rankings,omitempty"`
+	Approvals  []string       `json:"approvals,omitempty"`
+	Scores     map[string]int `json:"scores,omitempty"`
+	Salt       string         `json:"salt,omitempty"`
+	CastAt     int64          `json:"castAt,omitempty"`
+	BallotHash string         `json:"ballotHash,omitempty"`
+}
+
+// Tally aggregates an election's ballots. Counts holds plurality votes, first
+// preferences for ranked ballots, approvals for approval ballots, and for
+// score ballots the number of ballots that scored each candidate. Score
+// elections also report each candidate's total and mean score, the mean taken
+// over the ballots that scored the candidate.
+type Tally struct {
+	BallotType string             `json:"ballotType"`
+	Ballots    int                `json:"ballots"`
+	Counts     map[string]int     `json:"counts"`
+	Totals     map[string]int     `json:"totals,omitempty"`
+	Means      map[string]float64 `json:"means,omitempty"`
+	Unrevealed int                `json:"unrevealed,omitempty"`
 }
 
-func (pc *VoteSmartContract) CountVotes(ctx contractapi.TransactionContextInterface) (int, error) {
-	voteIterator, err := ctx.GetStub().GetStateByRange("", "")
+// putVote writes the ballot to ballotCollection and its hashed record to the
+// channel ledger under the same key, returning the ballot hash.
+func putVote(ctx contractapi.TransactionContextInterface, vote *Vote) (string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(voteObjectType, []string{vote.ElectionID, vote.ID})
 	if err != nil {
-		return 0, err
+		return "", err
 	}
-	defer voteIterator.Close()
-	count := 0
-	for voteIterator.HasNext() {
-		_, err := voteIterator.Next()
-		if err != nil {
-			return 0, err
-		}
-		count = count + 1
+	ballotJSON, record, err := sealBallot(vote)
+	if err != nil {
+		return "", err
+	}
+	err = ctx.GetStub().PutPrivateData(ballotCollection, key, ballotJSON)
+	if err != nil {
+		return "", err
 	}
-	return count, nil
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return "", err
+	}
+	return record.BallotHash, ctx.GetStub().PutState(key, recordJSON)
 }
 
-func (pc *VoteSmartContract) AddVote(ctx contractapi.TransactionContextInterface, candidate string) error {
-	count, err := pc.CountVotes(ctx)
-	id := strconv.Itoa(count + 1)
+// voterID derives a stable identifier for the voter from the submitting client
+// identity and, when the app submits on behalf of its users, the pseudonym it
+// passes. Only the hash is written to the ledger. The hash has no secret of
+// its own, so the app must pass a pseudonym that can't be guessed; the web
+// app passes an HMAC of the username under a key only it holds.
+func voterID(ctx contractapi.TransactionContextInterface, pseudonym string) (string, error) {
+	clientID, err := ctx.GetClientIdentity().GetID()
 	if err != nil {
-		return err
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(clientID + "|" + pseudonym))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func votedKey(ctx contractapi.TransactionContextInterface, electionID string, voter string) (string, error) {
+	id, err := voterID(ctx, voter)
+	if err != nil {
+		return "", err
+	}
+	return ctx.GetStub().CreateCompositeKey(votedObjectType, []string{electionID, id})
+}
+
+func (pc *VoteSmartContract) HasVoted(ctx contractapi.TransactionContextInterface, electionID string, voter string) (bool, error) {
+	key, err := votedKey(ctx, electionID, voter)
+	if err != nil {
+		return false, err
+	}
+	marker, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return false, err
+	}
+	return marker != nil, nil
+}
+
+// CountVotes reads the public ballot counters rather than scanning the
+// ballots. It reads one key per vote recorded since the election's last
+// CompactTally, so its cost is bounded by how often the tally is compacted
+// rather than by the size of the election.
+func (pc *VoteSmartContract) CountVotes(ctx contractapi.TransactionContextInterface, electionID string) (int, error) {
+	return readBallotCount(ctx, electionID)
+}
+
+// votingElection returns the election if it is currently inside its voting
+// window.
+func (pc *VoteSmartContract) votingElection(ctx contractapi.TransactionContextInterface, electionID string) (*Election, error) {
+	election, err := pc.GetElection(ctx, electionID)
+	if err != nil {
+		return nil, err
 	}
-	vote := Vote{
-		ID:        id,
-		Candidate: candidate,
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
 	}
-	voteJSON, err := json.Marshal(vote)
+	if !election.acceptsVotes(now) {
+		return nil, fmt.Errorf("election %s is not accepting votes", electionID)
+	}
+	return election, nil
+}
+
+func (pc *VoteSmartContract) assertCandidate(ctx contractapi.TransactionContextInterface, electionID string, candidate string) error {
+	registered, err := pc.GetCandidate(ctx, electionID, candidate)
 	if err != nil {
 		return err
 	}
-	err = ctx.GetStub().PutState(vote.ID, voteJSON)
-	return err
+	if registered.Withdrawn {
+		return fmt.Errorf("candidate %s has withdrawn from election %s", candidate, electionID)
+	}
+	return nil
 }
 
-func (pc *VoteSmartContract) InitLedger(ctx contractapi.TransactionContextInterface) error {
-	votes := []Vote{
-		{ID: "1", Candidate: "Ice Cream"},
-		{ID: "2", Candidate: "Pizza"},
-		{ID: "3", Candidate: "Pizza"},
-		{ID: "4", Candidate: "Pizza"},
-		{ID: "5", Candidate: "Hot Dogs"},
-		{ID: "6", Candidate: "Hot Dogs"},
-		{ID: "7", Candidate: "Hot Dogs"},
-		{ID: "8", Candidate: "Hot Dogs"},
-		{ID: "9", Candidate: "Salad"},
-		{ID: "10", Candidate: "Salad"},
+// decodeBallot parses ballotJSON as a ballot of the election's type and checks
+// it against the candidate registry and the election's limits.
+func (pc *VoteSmartContract) decodeBallot(ctx contractapi.TransactionContextInterface, election *Election, ballotJSON []byte) (*Vote, error) {
+	switch election.ballotType() {
+	case BallotRanked:
+		return pc.rankedBallot(ctx, election, ballotJSON)
+	case BallotApproval:
+		return pc.approvalBallot(ctx, election, ballotJSON)
+	case BallotScore:
+		return pc.scoreBallot(ctx, election, ballotJSON)
 	}
+	var candidate string
+	err := json.Unmarshal(ballotJSON, &candidate)
+	if err != nil {
+		return nil, err
+	}
+	err = pc.assertCandidate(ctx, election.ID, candidate)
+	if err != nil {
+		return nil, err
+	}
+	return &Vote{Candidate: candidate}, nil
+}
 
-	for _, vote := range votes {
-		voteJSON, err := json.Marshal(vote)
-		if err != nil {
-			return err
-		}
+// markVoted records that the voter has cast their ballot in the election,
+// failing with AlreadyVotedError if they already had.
+func markVoted(ctx contractapi.TransactionContextInterface, electionID string, voter string) error {
+	markerKey, err := votedKey(ctx, electionID, voter)
+	if err != nil {
+		return err
+	}
+	marker, err := ctx.GetStub().GetState(markerKey)
+	if err != nil {
+		return err
+	}
+	if marker != nil {
+		return &AlreadyVotedError{ElectionID: electionID}
+	}
+	return ctx.GetStub().PutState(markerKey, []byte("true"))
+}
 
-		err = ctx.GetStub().PutState(vote.ID, voteJSON)
-		if err != nil {
-			return err
-		}
+// recordVote stores the ballot, adds it to the tally counters and emits
+// VoteCast. It returns the voter's receipt.
+func (pc *VoteSmartContract) recordVote(ctx contractapi.TransactionContextInterface, vote *Vote) (*Receipt, error) {
+	castAt, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	vote.CastAt = castAt
+	ballotHash, err := putVote(ctx, vote)
+	if err != nil {
+		return nil, err
+	}
+	delta := newCounters()
+	delta.count(vote)
+	err = putTallyDelta(ctx, vote.ElectionID, delta, vote.Salt)
+	if err != nil {
+		return nil, err
+	}
+	err = setEvent(ctx, EventVoteCast, &Event{ElectionID: vote.ElectionID})
+	if err != nil {
+		return nil, err
+	}
+	return &Receipt{
+		TxID:       ctx.GetStub().GetTxID(),
+		ElectionID: vote.ElectionID,
+		VoteID:     vote.ID,
+		BallotHash: ballotHash,
+	}, nil
+}
+
+// addBallot backs the Add*Vote transactions. It reads the ballot, voter
+// pseudonym and salt from the transient map, validates the ballot against the
+// election and records it under the transaction ID.
+func (pc *VoteSmartContract) addBallot(ctx contractapi.TransactionContextInterface, electionID string, ballotType string) (*Receipt, error) {
+	election, err := pc.votingElection(ctx, electionID)
+	if err != nil {
+		return nil, err
+	}
+	if election.ballotType() != ballotType {
+		return nil, fmt.Errorf("election %s takes %s ballots", electionID, election.ballotType())
+	}
+	if election.CommitReveal {
+		return nil, fmt.Errorf("election %s takes committed ballots, use CommitVote", electionID)
+	}
+	ballotJSON, voter, salt, err := readTransient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	vote, err := pc.decodeBallot(ctx, election, ballotJSON)
+	if err != nil {
+		return nil, err
+	}
+	err = markVoted(ctx, electionID, voter)
+	if err != nil {
+		return nil, err
 	}
+	vote.ID = ctx.GetStub().GetTxID()
+	vote.ElectionID = electionID
+	vote.Salt = salt
+	return pc.recordVote(ctx, vote)
+}
+
+// AddVote casts a plurality ballot. The candidate ID, voter pseudonym and salt
+// are read from the transient map.
+func (pc *VoteSmartContract) AddVote(ctx contractapi.TransactionContextInterface, electionID string) (*Receipt, error) {
+	return pc.addBallot(ctx, electionID, BallotPlurality)
+}
 
+func (pc *VoteSmartContract) assertTallyVisible(ctx contractapi.TransactionContextInterface, electionID string) error {
+	election, err := pc.GetElection(ctx, electionID)
+	if err != nil {
+		return err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	if !election.tallyVisible(now) {
+		return fmt.Errorf("results for election %s are hidden until it closes", electionID)
+	}
 	return nil
 }
 
-func (pc *VoteSmartContract) TallyVotes(ctx contractapi.TransactionContextInterface) (map[string]int, error) {
-	voteIterator, err := ctx.GetStub().GetStateByRange("", "")
+// TallyVotes reads the tally counters maintained as votes are recorded rather
+// than scanning the ballots. The candidate counts live in ballotCollection, so
+// it must be evaluated on a peer of a collection member.
+func (pc *VoteSmartContract) TallyVotes(ctx contractapi.TransactionContextInterface, electionID string) (*Tally, error) {
+	election, err := pc.GetElection(ctx, electionID)
 	if err != nil {
 		return nil, err
 	}
-	defer voteIterator.Close()
-	tally := map[string]int{}
-	for voteIterator.HasNext() {
-		voteResponse, err := voteIterator.Next()
-		if err != nil {
-			return nil, err
-		}
-		var vote *Vote
-		err = json.Unmarshal(voteResponse.Value, &vote)
+	err = pc.assertTallyVisible(ctx, electionID)
+	if err != nil {
+		return nil, err
+	}
+	c, err := readCounters(ctx, electionID)
+	if err != nil {
+		return nil, err
+	}
+	tally := election.tally(c)
+	if election.CommitReveal {
+		tally.Unrevealed, err = countUnrevealed(ctx, electionID)
 		if err != nil {
 			return nil, err
 		}
-		if count, ok := tally[vote.Candidate]; ok {
-			tally[vote.Candidate] = count + 1
-		} else {
-			tally[vote.Candidate] = 1
-		}
 	}
 	return tally, nil
 }
 
-func (pc *VoteSmartContract) QueryAllVotes(ctx contractapi.TransactionContextInterface) ([]*Vote, error) {
-	voteIterator, err := ctx.GetStub().GetStateByRange("", "")
+// QueryAllVotes returns the election's ballots from ballotCollection, so it
+// must be evaluated on a peer of a collection member.
+func (pc *VoteSmartContract) QueryAllVotes(ctx contractapi.TransactionContextInterface, electionID string) ([]*Vote, error) {
+	err := pc.assertTallyVisible(ctx, electionID)
+	if err != nil {
+		return nil, err
+	}
+	voteIterator, err := ctx.GetStub().GetPrivateDataByPartialCompositeKey(ballotCollection, voteObjectType, []string{electionID})
 	if err != nil {
 		return nil, err
 	}
@@ -131,6 +332,7 @@ func (pc *VoteSmartContract) QueryAllVotes(ctx contractapi.TransactionContextInt
 
 func main() {
 	voteSmartContract := new(VoteSmartContract)
+	voteSmartContract.BeforeTransaction = checkAccess
 	cc, err := contractapi.NewChaincode(voteSmartContract)
 	if err != nil {
 		panic(err.Error)
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/labstack/echo/v4"
+)
+
+// HistoryEntry mirrors the chaincode's HistoryEntry, one committed write to a
+// ledger key.
+type HistoryEntry struct {
+	TxID      string `json:"txId"`
+	Timestamp int64  `json:"timestamp"`
+	IsDelete  bool   `json:"isDelete"`
+	Value     string `json:"value"`
+}
+
+// Time formats the entry's commit time for the audit trail.
+func (h HistoryEntry) Time() string {
+	return time.Unix(h.Timestamp, 0).UTC().Format(time.RFC3339)
+}
+
+// auditRecords lists the kinds of record the audit trail can look up.
+var auditRecords = []Option{
+	{Name: "election", Id: 1},
+	{Name: "candidate", Id: 2},
+	{Name: "vote", Id: 3},
+}
+
+// keyHistory fetches the audit trail of the election itself, or of one of its
+// candidates or votes by ID. An unknown record kind is a bad request.
+func keyHistory(contract *client.Contract, electionID string, record string, id string) ([]HistoryEntry, error) {
+	history := []HistoryEntry{}
+	var err error
+	switch record {
+	case "election":
+		err = evaluate(contract, &history, "GetElectionHistory", electionID)
+	case "candidate":
+		err = evaluate(contract, &history, "GetCandidateHistory", electionID, id)
+	case "vote":
+		err = evaluate(contract, &history, "GetVoteHistory", electionID, id)
+	default:
+		return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown record %s", record))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return history, nil
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	metaBucket        = []byte("meta")
+	usersBucket       = []byte("users")
+	sessionsBucket    = []byte("sessions")
+	rollBucket        = []byte("roll")
+	invitationsBucket = []byte("invitations")
+
+	schemaVersionKey = []byte("schemaVersion")
+)
+
+// migrations bring a store file up to the current schema. Each runs once, in
+// order, and the number applied is recorded in the meta bucket, so new
+// migrations are only ever appended.
+var migrations = []func(tx *bolt.Tx) error{
+	func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(usersBucket)
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists(sessionsBucket)
+		return err
+	},
+	// Sessions gain an expiry. They only live for one WebAuthn ceremony, so
+	// any left from before are dropped rather than converted.
+	func(tx *bolt.Tx) error {
+		err := tx.DeleteBucket(sessionsBucket)
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucket(sessionsBucket)
+		return err
+	},
+	// Voter rolls and registration invitations.
+	func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(rollBucket)
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists(invitationsBucket)
+		return err
+	},
+}
+
+// Bolt is a PasskeyStore kept in a bbolt file so registered passkeys survive
+// restarts. PasskeyStore has no error returns, so failures are logged and
+// reads fall back to empty values, as InMem does for unknown keys.
+type Bolt struct {
+	db      *bolt.DB
+	expired atomic.Int64
+
+	log Logger
+}
+
+// storedSession is how a session is written to the sessions bucket.
+type storedSession struct {
+	Data    webauthn.SessionData `json:"data"`
+	Expires time.Time            `json:"expires"`
+}
+
+// storedUser is how a PasskeyUser is written to the users bucket.
+type storedUser struct {
+	ID          []byte                `json:"id"`
+	DisplayName string                `json:"displayName"`
+	Name        string                `json:"name"`
+	Credentials []webauthn.Credential `json:"credentials"`
+}
+
+func NewBolt(path string, log Logger) (*Bolt, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = migrate(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Bolt{
+		db:  db,
+		log: log,
+	}, nil
+}
+
+func migrate(db *bolt.DB) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil {
+			return err
+		}
+		version := 0
+		if versionJSON := meta.Get(schemaVersionKey); versionJSON != nil {
+			err = json.Unmarshal(versionJSON, &version)
+			if err != nil {
+				return err
+			}
+		}
+		if version > len(migrations) {
+			return fmt.Errorf("store schema version %d is newer than this app supports (%d)", version, len(migrations))
+		}
+		for ; version < len(migrations); version++ {
+			err = migrations[version](tx)
+			if err != nil {
+				return fmt.Errorf("migration %d: %w", version+1, err)
+			}
+		}
+		versionJSON, err := json.Marshal(version)
+		if err != nil {
+			return err
+		}
+		return meta.Put(schemaVersionKey, versionJSON)
+	})
+}
+
+func (b *Bolt) Close() error {
+	return b.db.Close()
+}
+
+func (b *Bolt) get(bucket []byte, key string, value interface{}) (bool, error) {
+	found := false
+	err := b.db.View(func(tx *bolt.Tx) error {
+		valueJSON := tx.Bucket(bucket).Get([]byte(key))
+		if valueJSON == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(valueJSON, value)
+	})
+	return found, err
+}
+
+func (b *Bolt) put(bucket []byte, key string, value interface{}) error {
+	valueJSON, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put([]byte(key), valueJSON)
+	})
+}
+
+func (b *Bolt) GetSession(token string) webauthn.SessionData {
+	var session storedSession
+	found, err := b.get(sessionsBucket, token, &session)
+	if err != nil {
+		b.log.Printf("[ERRO] GetSession: %v", err)
+		return webauthn.SessionData{}
+	}
+	if found && !time.Now().Before(session.Expires) {
+		b.log.Printf("[DEBUG] GetSession: %v expired", token)
+		b.DeleteSession(token)
+		b.expired.Add(1)
+		return webauthn.SessionData{}
+	}
+	return session.Data
+}
+
+func (b *Bolt) SaveSession(token string, data webauthn.SessionData) {
+	b.log.Printf("[DEBUG] SaveSession: %s", token)
+	err := b.put(sessionsBucket, token, storedSession{
+		Data:    data,
+		Expires: sessionExpiry(data, time.Now()),
+	})
+	if err != nil {
+		b.log.Printf("[ERRO] SaveSession: %v", err)
+	}
+}
+
+func (b *Bolt) DeleteSession(token string) {
+	b.log.Printf("[DEBUG] DeleteSession: %v", token)
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(sessionsBucket).Delete([]byte(token))
+	})
+	if err != nil {
+		b.log.Printf("[ERRO] DeleteSession: %v", err)
+	}
+}
+
+// ExpireSessions drops sessions that expired by now and returns how many.
+func (b *Bolt) ExpireSessions(now time.Time) int {
+	expired := 0
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		sessions := tx.Bucket(sessionsBucket)
+		var tokens [][]byte
+		err := sessions.ForEach(func(token []byte, sessionJSON []byte) error {
+			var session storedSession
+			err := json.Unmarshal(sessionJSON, &session)
+			if err != nil || !now.Before(session.Expires) {
+				tokens = append(tokens, token)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, token := range tokens {
+			err = sessions.Delete(token)
+			if err != nil {
+				return err
+			}
+		}
+		expired = len(tokens)
+		return nil
+	})
+	if err != nil {
+		b.log.Printf("[ERRO] ExpireSessions: %v", err)
+		return 0
+	}
+	b.expired.Add(int64(expired))
+	return expired
+}
+
+func (b *Bolt) Stats() StoreStats {
+	stats := StoreStats{
+		ExpiredSessions: int(b.expired.Load()),
+	}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		stats.Users = tx.Bucket(usersBucket).Stats().KeyN
+		stats.ActiveSessions = tx.Bucket(sessionsBucket).Stats().KeyN
+		return nil
+	})
+	if err != nil {
+		b.log.Printf("[ERRO] Stats: %v", err)
+	}
+	return stats
+}
+
+func (b *Bolt) GetUser(userName string) (PasskeyUser, bool) {
+	b.log.Printf("[DEBUG] GetUser: %v", userName)
+	var stored storedUser
+	found, err := b.get(usersBucket, userName, &stored)
+	if err != nil {
+		b.log.Printf("[ERRO] GetUser: %v", err)
+	}
+	if !found || err != nil {
+		return nil, false
+	}
+	return &User{
+		ID:          stored.ID,
+		DisplayName: stored.DisplayName,
+		Name:        stored.Name,
+		creds:       stored.Credentials,
+	}, true
+}
+
+func (b *Bolt) SaveUser(user PasskeyUser) {
+	b.log.Printf("[DEBUG] SaveUser: %v", user.WebAuthnName())
+	err := b.put(usersBucket, user.WebAuthnName(), storedUser{
+		ID:          user.WebAuthnID(),
+		DisplayName: user.WebAuthnDisplayName(),
+		Name:        user.WebAuthnName(),
+		Credentials: user.WebAuthnCredentials(),
+	})
+	if err != nil {
+		b.log.Printf("[ERRO] SaveUser: %v", err)
+	}
+}
+
+func (b *Bolt) AddToRoll(electionID string, username string) {
+	err := b.put(rollBucket, rollKey(electionID, username), true)
+	if err != nil {
+		b.log.Printf("[ERRO] AddToRoll: %v", err)
+	}
+}
+
+func (b *Bolt) OnRoll(electionID string, username string) bool {
+	var onRoll bool
+	_, err := b.get(rollBucket, rollKey(electionID, username), &onRoll)
+	if err != nil {
+		b.log.Printf("[ERRO] OnRoll: %v", err)
+		return false
+	}
+	return onRoll
+}
+
+func (b *Bolt) SaveInvitation(key string, invitation Invitation) {
+	err := b.put(invitationsBucket, key, invitation)
+	if err != nil {
+		b.log.Printf("[ERRO] SaveInvitation: %v", err)
+	}
+}
+
+func (b *Bolt) GetInvitation(key string) (Invitation, bool) {
+	var invitation Invitation
+	found, err := b.get(invitationsBucket, key, &invitation)
+	if err != nil {
+		b.log.Printf("[ERRO] GetInvitation: %v", err)
+		return Invitation{}, false
+	}
+	return invitation, found
+}
+
+func (b *Bolt) DeleteInvitation(key string) {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(invitationsBucket).Delete([]byte(key))
+	})
+	if err != nil {
+		b.log.Printf("[ERRO] DeleteInvitation: %v", err)
+	}
+}
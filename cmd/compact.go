@@ -0,0 +1,79 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+// compactAttempts is how many ticks in a row startCompactor tries an
+// election's compaction before waiting for its next vote.
+const compactAttempts = 3
+
+// startCompactor submits CompactTally every interval for each election that
+// has had votes cast since it was last compacted, until stop is called. Every
+// vote adds a delta key to its election's tally, so without compaction reading
+// the tally gets slower with every vote. contract must act as a tally
+// maintainer. An election whose compaction fails, typically because a vote
+// committed while it ran, is retried on the next tick, up to compactAttempts
+// times.
+func startCompactor(interval time.Duration, log Logger, contract *client.Contract, events *Events) (stop func()) {
+	var mu sync.Mutex
+	// pending counts the attempts left for each election due compaction.
+	pending := map[string]int{}
+	events.Hook(func(event Event) {
+		if event.Name != "VoteCast" {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		pending[event.ElectionID] = compactAttempts
+	})
+
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				mu.Lock()
+				due := pending
+				pending = map[string]int{}
+				mu.Unlock()
+
+				for electionID, attempts := range due {
+					err := compactTally(contract, electionID)
+					if err == nil {
+						continue
+					}
+					log.Printf("[WARN] can't compact tally of %s: %s", electionID, err.Error())
+					if attempts > 1 {
+						mu.Lock()
+						if _, voted := pending[electionID]; !voted {
+							pending[electionID] = attempts - 1
+						}
+						mu.Unlock()
+					}
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// compactTally folds the election's tally deltas into its base counters. The
+// chaincode keeps the candidate counts private, salted with a fresh salt.
+func compactTally(contract *client.Contract, electionID string) error {
+	salt, err := newSalt()
+	if err != nil {
+		return err
+	}
+	_, err = submitTransient(contract, "CompactTally", map[string][]byte{
+		"salt": []byte(salt),
+	}, electionID)
+	return err
+}
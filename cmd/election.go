@@ -0,0 +1,441 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/labstack/echo/v4"
+	"github.com/wcharczuk/go-chart/v2"
+)
+
+const (
+	BallotRanked   = "ranked"
+	BallotApproval = "approval"
+	BallotScore    = "score"
+)
+
+// Election mirrors the chaincode's Election asset as returned by GetElection.
+type Election struct {
+	ID         string   `json:"id"`
+	Title      string   `json:"title"`
+	OpensAt    int64    `json:"opensAt"`
+	ClosesAt   int64    `json:"closesAt"`
+	Status     string   `json:"status"`
+	HideTally  bool     `json:"hideTally"`
+	BallotType string   `json:"ballotType"`
+	Limit      int      `json:"limit"`
+	Candidates []string `json:"candidates"`
+
+	CommitReveal   bool  `json:"commitReveal"`
+	RevealClosesAt int64 `json:"revealClosesAt"`
+}
+
+// Tally mirrors the chaincode's method-aware TallyVotes result.
+type Tally struct {
+	BallotType string             `json:"ballotType"`
+	Ballots    int                `json:"ballots"`
+	Counts     map[string]int     `json:"counts"`
+	Totals     map[string]int     `json:"totals"`
+	Means      map[string]float64 `json:"means"`
+	Unrevealed int                `json:"unrevealed"`
+}
+
+// RankedResult mirrors the chaincode's instant-runoff result.
+type RankedResult struct {
+	Rounds []struct {
+		Round      int            `json:"round"`
+		Counts     map[string]int `json:"counts"`
+		Exhausted  int            `json:"exhausted"`
+		Eliminated []string       `json:"eliminated"`
+	} `json:"rounds"`
+	Winner string `json:"winner"`
+}
+
+// Count is one bar of a results chart: votes, approvals or a mean score.
+type Count struct {
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
+}
+
+// BallotError is a problem with a submitted ballot that the voter can fix. It
+// is shown on the ballot instead of failing the request.
+type BallotError struct {
+	Message string
+}
+
+func (e *BallotError) Error() string {
+	return e.Message
+}
+
+func ballotErrorf(format string, a ...interface{}) error {
+	return &BallotError{Message: fmt.Sprintf(format, a...)}
+}
+
+// Round is an instant-runoff round with candidate IDs resolved to names for
+// the ranked-results template.
+type Round struct {
+	Number     int      `json:"number"`
+	Counts     []Count  `json:"counts"`
+	Exhausted  int      `json:"exhausted,omitempty"`
+	Eliminated []string `json:"eliminated,omitempty"`
+}
+
+func getElection(contract *client.Contract, electionID string) (*Election, error) {
+	var election Election
+	err := evaluate(contract, &election, "GetElection", electionID)
+	if err != nil {
+		return nil, err
+	}
+	return &election, nil
+}
+
+func tallyRanked(contract *client.Contract, electionID string) (*RankedResult, error) {
+	var result RankedResult
+	err := evaluate(contract, &result, "TallyRanked", electionID)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func candidateNames(candidates []Candidate) map[string]string {
+	names := map[string]string{}
+	for _, candidate := range candidates {
+		names[candidate.ID] = candidate.Name
+	}
+	return names
+}
+
+func candidateName(names map[string]string, id string) string {
+	if name, ok := names[id]; ok {
+		return name
+	}
+	return id
+}
+
+// sortCounts orders counts from highest to lowest value, then by name.
+func sortCounts(counts []Count) {
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Value != counts[j].Value {
+			return counts[i].Value > counts[j].Value
+		}
+		return counts[i].Name < counts[j].Name
+	})
+}
+
+// tallyCounts picks the aggregate to chart for the tally's ballot type: mean
+// scores for score elections, otherwise votes or approvals.
+func tallyCounts(tally *Tally, names map[string]string) []Count {
+	counts := []Count{}
+	if tally.BallotType == BallotScore {
+		for id, mean := range tally.Means {
+			counts = append(counts, Count{Name: candidateName(names, id), Value: mean})
+		}
+	} else {
+		for id, votes := range tally.Counts {
+			counts = append(counts, Count{Name: candidateName(names, id), Value: float64(votes)})
+		}
+	}
+	sortCounts(counts)
+	return counts
+}
+
+// rankedRounds resolves candidate IDs to names and orders each round's counts
+// from most to fewest votes.
+func rankedRounds(result *RankedResult, names map[string]string) []Round {
+	rounds := []Round{}
+	for _, r := range result.Rounds {
+		round := Round{
+			Number:    r.Round,
+			Exhausted: r.Exhausted,
+		}
+		for id, votes := range r.Counts {
+			round.Counts = append(round.Counts, Count{Name: candidateName(names, id), Value: float64(votes)})
+		}
+		sortCounts(round.Counts)
+		for _, id := range r.Eliminated {
+			round.Eliminated = append(round.Eliminated, candidateName(names, id))
+		}
+		rounds = append(rounds, round)
+	}
+	return rounds
+}
+
+// parseRankings reads the rank-<candidate ID> fields of a ranked ballot and
+// returns the candidate IDs ordered by rank. Unranked candidates are left off.
+func parseRankings(context echo.Context, candidates []Candidate) ([]string, error) {
+	ranks := map[int]string{}
+	for _, candidate := range candidates {
+		value := context.FormValue("rank-" + candidate.ID)
+		if value == "" {
+			continue
+		}
+		rank, err := strconv.Atoi(value)
+		if err != nil || rank < 1 {
+			return nil, ballotErrorf("%s has an invalid rank", candidate.Name)
+		}
+		if _, ok := ranks[rank]; ok {
+			return nil, ballotErrorf("rank %d is used more than once", rank)
+		}
+		ranks[rank] = candidate.ID
+	}
+	if len(ranks) == 0 {
+		return nil, ballotErrorf("rank at least one candidate")
+	}
+	order := []int{}
+	for rank := range ranks {
+		order = append(order, rank)
+	}
+	sort.Ints(order)
+	rankings := []string{}
+	for _, rank := range order {
+		rankings = append(rankings, ranks[rank])
+	}
+	return rankings, nil
+}
+
+// parseScores reads the score-<candidate ID> fields of a score ballot.
+// Candidates left blank are not scored.
+func parseScores(context echo.Context, candidates []Candidate, limit int) (map[string]int, error) {
+	scores := map[string]int{}
+	for _, candidate := range candidates {
+		value := context.FormValue("score-" + candidate.ID)
+		if value == "" {
+			continue
+		}
+		score, err := strconv.Atoi(value)
+		if err != nil || score < 0 || score > limit {
+			return nil, ballotErrorf("score %s from 0 to %d", candidate.Name, limit)
+		}
+		scores[candidate.ID] = score
+	}
+	if len(scores) == 0 {
+		return nil, ballotErrorf("score at least one candidate")
+	}
+	return scores, nil
+}
+
+// ballotTemplate names the template that renders the election's ballot.
+func ballotTemplate(election *Election) string {
+	switch election.BallotType {
+	case BallotRanked:
+		return "ranked-voting"
+	case BallotApproval:
+		return "approval-voting"
+	case BallotScore:
+		return "score-voting"
+	}
+	return "voting"
+}
+
+func ballotForm(election *Election) FormData {
+	form := NewFormData()
+	form.Values["limit"] = strconv.Itoa(election.Limit)
+	return form
+}
+
+// readBallot reads the ballot for the election's type from the submitted form
+// and names the chaincode transaction that casts it. Ballots that are
+// incomplete or out of range come back as *BallotError.
+func readBallot(context echo.Context, election *Election, candidates []Candidate) (string, interface{}, error) {
+	switch election.BallotType {
+	case BallotRanked:
+		rankings, err := parseRankings(context, candidates)
+		if err != nil {
+			return "", nil, err
+		}
+		return "AddRankedVote", rankings, nil
+	case BallotApproval:
+		params, err := context.FormParams()
+		if err != nil {
+			return "", nil, err
+		}
+		approvals := params["approve"]
+		if len(approvals) == 0 {
+			return "", nil, ballotErrorf("approve at least one candidate")
+		}
+		if election.Limit > 0 && len(approvals) > election.Limit {
+			return "", nil, ballotErrorf("approve at most %d candidates", election.Limit)
+		}
+		return "AddApprovalVote", approvals, nil
+	case BallotScore:
+		scores, err := parseScores(context, candidates, election.Limit)
+		if err != nil {
+			return "", nil, err
+		}
+		return "AddScoreVote", scores, nil
+	}
+	candidate := context.FormValue("preselect")
+	if candidate == "" {
+		return "", nil, ballotErrorf("choose a candidate")
+	}
+	return "AddVote", candidate, nil
+}
+
+// castBallot sends the submitted ballot to the chaincode and returns the
+// voter's receipt. Commit-reveal elections only receive its commitment, so
+// instead of a receipt they return the reveal code the voter must bring back
+// to have it counted.
+func castBallot(context echo.Context, contract *client.Contract, election *Election, candidates []Candidate, voter string) (*Receipt, string, error) {
+	function, ballot, err := readBallot(context, election, candidates)
+	if err != nil {
+		return nil, "", err
+	}
+	ballotJSON, err := json.Marshal(ballot)
+	if err != nil {
+		return nil, "", err
+	}
+	salt, err := newSalt()
+	if err != nil {
+		return nil, "", err
+	}
+	if election.CommitReveal {
+		code, err := commitBallot(contract, election.ID, ballotJSON, salt, voter)
+		return nil, code, err
+	}
+	receiptJSON, err := submitTransient(contract, function, map[string][]byte{
+		"ballot": ballotJSON,
+		"voter":  []byte(voter),
+		"salt":   []byte(salt),
+	}, election.ID)
+	if err != nil {
+		return nil, "", err
+	}
+	receipt, err := parseReceipt(receiptJSON)
+	return receipt, "", err
+}
+
+func newSalt() (string, error) {
+	salt := make([]byte, 16)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(salt), nil
+}
+
+// submitTransient submits function with the given transient data, which the
+// chaincode keeps off the channel ledger. Only args travel as transaction
+// arguments. It returns once the transaction commits, or with a
+// *client.CommitError if validation rejected it.
+func submitTransient(contract *client.Contract, function string, transient map[string][]byte, args ...string) ([]byte, error) {
+	return contract.Submit(function, client.WithArguments(args...), client.WithTransient(transient))
+}
+
+// RevealCode is everything RevealVote needs to count a committed ballot. It is
+// handed to the voter base64-encoded rather than stored by the app.
+type RevealCode struct {
+	Commitment string          `json:"commitment"`
+	Ballot     json.RawMessage `json:"ballot"`
+	Salt       string          `json:"salt"`
+}
+
+// commitBallot submits the SHA-256 of salt followed by ballotJSON to
+// CommitVote and returns the voter's reveal code.
+func commitBallot(contract *client.Contract, electionID string, ballotJSON []byte, salt string, voter string) (string, error) {
+	sum := sha256.Sum256(append([]byte(salt), ballotJSON...))
+	commitmentID, err := submitTransient(contract, "CommitVote", map[string][]byte{
+		"commitment": []byte(hex.EncodeToString(sum[:])),
+		"voter":      []byte(voter),
+	}, electionID)
+	if err != nil {
+		return "", err
+	}
+	codeJSON, err := json.Marshal(RevealCode{
+		Commitment: string(commitmentID),
+		Ballot:     ballotJSON,
+		Salt:       salt,
+	})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(codeJSON), nil
+}
+
+// revealBallot decodes a reveal code, submits it to RevealVote and returns the
+// voter's receipt. A code that cannot be decoded comes back as *BallotError.
+func revealBallot(contract *client.Contract, electionID string, code string) (*Receipt, error) {
+	codeJSON, err := base64.RawURLEncoding.DecodeString(strings.TrimSpace(code))
+	if err != nil {
+		return nil, ballotErrorf("reveal code is not valid")
+	}
+	var reveal RevealCode
+	err = json.Unmarshal(codeJSON, &reveal)
+	if err != nil || reveal.Commitment == "" {
+		return nil, ballotErrorf("reveal code is not valid")
+	}
+	receiptJSON, err := submitTransient(contract, "RevealVote", map[string][]byte{
+		"ballot": reveal.Ballot,
+		"salt":   []byte(reveal.Salt),
+	}, electionID, reveal.Commitment)
+	if err != nil {
+		return nil, err
+	}
+	return parseReceipt(receiptJSON)
+}
+
+// chartMu serializes writes to images/tally.png, which every results request
+// and live results stream redraws.
+var chartMu sync.Mutex
+
+// renderTallyChart draws counts as a bar chart into images/tally.png, which
+// the results templates display.
+func renderTallyChart(counts []Count) error {
+	chartMu.Lock()
+	defer chartMu.Unlock()
+
+	values := []chart.Value{}
+	// go-chart can't derive a range from bars that are all the same height,
+	// as with a single candidate or no votes yet, so fix it from zero.
+	top := 1.0
+	for _, count := range counts {
+		value := chart.Value{
+			Label: count.Name,
+			Value: count.Value,
+		}
+		values = append(values, value)
+		top = math.Max(top, count.Value)
+	}
+
+	bar := chart.BarChart{
+		Title: "Results",
+		Background: chart.Style{
+			Padding: chart.Box{
+				Top: 30,
+			},
+		},
+		Height:   256,
+		BarWidth: 50,
+		Bars:     values,
+		YAxis: chart.YAxis{
+			Range: &chart.ContinuousRange{Min: 0, Max: top},
+		},
+	}
+
+	buffer := bytes.NewBuffer([]byte{})
+	err := bar.Render(chart.PNG, buffer)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create("images/tally.png")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = buffer.WriteTo(f)
+	return err
+}
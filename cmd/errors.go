@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	gatewaypb "github.com/hyperledger/fabric-protos-go-apiv2/gateway"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"github.com/labstack/echo/v4"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorKind says what went wrong with a request in terms the voter can act
+// on, independent of which layer of the gateway reported it.
+type ErrorKind int
+
+const (
+	// ErrInternal is anything we can't explain to the voter.
+	ErrInternal ErrorKind = iota
+	// ErrValidation is the chaincode refusing the request, e.g. a vote for a
+	// closed election. Its message is the chaincode's and is safe to show.
+	ErrValidation
+	// ErrAlreadyVoted is the chaincode's AlreadyVotedError.
+	ErrAlreadyVoted
+	// ErrConflict is a transaction invalidated at commit by a concurrent one
+	// touching the same keys. Submitting again usually succeeds.
+	ErrConflict
+	// ErrEndorsement is the peers failing to endorse, or endorsing
+	// inconsistently, for reasons other than the chaincode saying no.
+	ErrEndorsement
+	// ErrTimeout is the gateway giving up waiting on a peer or for the
+	// transaction to commit.
+	ErrTimeout
+	// ErrRequest is a problem with the HTTP request itself.
+	ErrRequest
+	// ErrForbidden is a logged-in user doing something they may not, such as
+	// voting when they are not on the election's roll.
+	ErrForbidden
+)
+
+var errorStatus = map[ErrorKind]int{
+	ErrInternal:     http.StatusInternalServerError,
+	ErrValidation:   http.StatusUnprocessableEntity,
+	ErrAlreadyVoted: http.StatusConflict,
+	ErrConflict:     http.StatusConflict,
+	ErrEndorsement:  http.StatusBadGateway,
+	ErrTimeout:      http.StatusGatewayTimeout,
+	ErrRequest:      http.StatusBadRequest,
+	ErrForbidden:    http.StatusForbidden,
+}
+
+// AppError is a failed request classified for the error handler. Message is
+// shown to the voter; Err is only logged.
+type AppError struct {
+	Kind    ErrorKind
+	Status  int
+	Message string
+	Err     error
+}
+
+func (e *AppError) Error() string {
+	if e.Err == nil {
+		return e.Message
+	}
+	return e.Err.Error()
+}
+
+func (e *AppError) Unwrap() error {
+	return e.Err
+}
+
+func newAppError(kind ErrorKind, message string, err error) *AppError {
+	return &AppError{Kind: kind, Status: errorStatus[kind], Message: message, Err: err}
+}
+
+// chaincodeFailure precedes the chaincode's own message in the peer's
+// response when a transaction function returns an error.
+const chaincodeFailure = "chaincode response 500, "
+
+// alreadyVotedMessage matches the message of the chaincode's AlreadyVotedError.
+const alreadyVotedMessage = "already voted in election"
+
+// chaincodeMessage finds the chaincode's error message in a gateway status,
+// either in its message or, when endorsing, in the details from each peer.
+func chaincodeMessage(s *status.Status) (string, bool) {
+	messages := []string{s.Message()}
+	for _, detail := range s.Details() {
+		if detail, ok := detail.(*gatewaypb.ErrorDetail); ok {
+			messages = append(messages, detail.GetMessage())
+		}
+	}
+	for _, message := range messages {
+		if i := strings.LastIndex(message, chaincodeFailure); i >= 0 {
+			return message[i+len(chaincodeFailure):], true
+		}
+	}
+	return "", false
+}
+
+// classifyError maps an error from a handler, usually one returned by the
+// gateway, to an AppError.
+func classifyError(err error) *AppError {
+	var appErr *AppError
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		message, ok := httpErr.Message.(string)
+		if !ok {
+			message = http.StatusText(httpErr.Code)
+		}
+		return &AppError{Kind: ErrRequest, Status: httpErr.Code, Message: message, Err: err}
+	}
+	var ballotErr *BallotError
+	if errors.As(err, &ballotErr) {
+		return newAppError(ErrValidation, ballotErr.Error(), err)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return newAppError(ErrTimeout, "The ledger took too long to respond, please try again.", err)
+	}
+	var commitErr *client.CommitError
+	if errors.As(err, &commitErr) {
+		switch commitErr.Code {
+		case peer.TxValidationCode_MVCC_READ_CONFLICT, peer.TxValidationCode_PHANTOM_READ_CONFLICT:
+			return newAppError(ErrConflict, "Someone else updated the ledger at the same time, please submit again.", err)
+		}
+		return newAppError(ErrEndorsement, "The ledger could not endorse your request, please try again.", err)
+	}
+
+	s, ok := status.FromError(err)
+	if !ok {
+		return newAppError(ErrInternal, "Something went wrong, please try again.", err)
+	}
+	if message, ok := chaincodeMessage(s); ok {
+		if strings.Contains(message, alreadyVotedMessage) {
+			return newAppError(ErrAlreadyVoted, "You have already voted in this election.", err)
+		}
+		return newAppError(ErrValidation, message, err)
+	}
+	switch s.Code() {
+	case codes.DeadlineExceeded:
+		return newAppError(ErrTimeout, "The ledger took too long to respond, please try again.", err)
+	case codes.Unavailable:
+		return newAppError(ErrEndorsement, "The ledger is unavailable, please try again.", err)
+	case codes.Aborted, codes.FailedPrecondition, codes.Unknown:
+		return newAppError(ErrEndorsement, "The ledger could not endorse your request, please try again.", err)
+	}
+	return newAppError(ErrInternal, "Something went wrong, please try again.", err)
+}
+
+// errorHandler replaces echo's default so gateway failures reach the voter as
+// a message rather than a bare 500. htmx requests get a fragment: in place of
+// the whole page when they were going to replace #content, otherwise in the
+// element they targeted. Everything else gets the message as JSON, like the
+// passkey endpoints.
+func errorHandler(err error, context echo.Context) {
+	if context.Response().Committed {
+		return
+	}
+	appErr := classifyError(err)
+	if appErr.Status >= http.StatusInternalServerError {
+		l.Printf("[ERRO] %s %s: %s", context.Request().Method, context.Request().URL.Path, appErr.Error())
+	}
+
+	form := NewFormData()
+	form.Errors["error"] = appErr.Message
+	if context.Request().Header.Get("HX-Request") == "true" {
+		name := "error-message"
+		if context.Request().Header.Get("HX-Target") == "content" {
+			name = "error"
+		}
+		err = context.Render(appErr.Status, name, form)
+	} else if context.Request().Method == http.MethodHead {
+		err = context.NoContent(appErr.Status)
+	} else {
+		err = context.JSON(appErr.Status, appErr.Message)
+	}
+	if err != nil {
+		l.Printf("[ERRO] can't render error: %s", err.Error())
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+// eventFilter matches the chaincode events the app reacts to.
+const eventFilter = "^(VoteCast|ElectionOpened|ElectionClosed|CandidateAdded)$"
+
+// Event is a chaincode event with its JSON payload decoded.
+type Event struct {
+	Name        string `json:"name"`
+	TxID        string `json:"txId"`
+	ElectionID  string `json:"electionId"`
+	Status      string `json:"status,omitempty"`
+	CandidateID string `json:"candidateId,omitempty"`
+}
+
+// Events fans chaincode events out to every subscriber. Subscribers that fall
+// behind miss events rather than holding up the others. Hooks run before any
+// subscriber hears of an event, so caches they clear are already fresh when
+// subscribers react to it.
+type Events struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]bool
+	hooks       []func(Event)
+}
+
+func NewEvents() *Events {
+	return &Events{
+		subscribers: map[chan Event]bool{},
+	}
+}
+
+func (e *Events) Subscribe() chan Event {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	events := make(chan Event, 16)
+	e.subscribers[events] = true
+	return events
+}
+
+func (e *Events) Unsubscribe(events chan Event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.subscribers[events] {
+		delete(e.subscribers, events)
+		close(events)
+	}
+}
+
+// Hook calls hook with every event, before subscribers receive it. Hooks must
+// not block.
+func (e *Events) Hook(hook func(Event)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.hooks = append(e.hooks, hook)
+}
+
+func (e *Events) publish(event Event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, hook := range e.hooks {
+		hook(event)
+	}
+	for events := range e.subscribers {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
+
+// eventRetry is how long Listen waits before reopening a dropped event stream.
+const eventRetry = 5 * time.Second
+
+// Checkpointer records the last chaincode event the app has handled, so a
+// reopened event stream resumes after it. Close releases the checkpoint's
+// file once the event stream has stopped.
+type Checkpointer interface {
+	client.Checkpoint
+	CheckpointChaincodeEvent(event *client.ChaincodeEvent) error
+	Close() error
+}
+
+// memoryCheckpointer is a Checkpointer that is forgotten on restart.
+type memoryCheckpointer struct {
+	client.InMemoryCheckpointer
+}
+
+func (c *memoryCheckpointer) CheckpointChaincodeEvent(event *client.ChaincodeEvent) error {
+	c.InMemoryCheckpointer.CheckpointChaincodeEvent(event)
+	return nil
+}
+
+func (c *memoryCheckpointer) Close() error {
+	return nil
+}
+
+// newCheckpointer keeps the checkpoint in the file at path, or in memory if
+// path is empty, in which case events committed while the app was down are
+// not replayed.
+func newCheckpointer(path string) (Checkpointer, error) {
+	if path == "" {
+		return &memoryCheckpointer{}, nil
+	}
+	return client.NewFileCheckpointer(path)
+}
+
+// Listen reads the chaincode's events from the peer's Gateway service and
+// publishes the ones matching eventFilter until stop is called. Every event is
+// checkpointed once published. When the stream drops, it is reopened from the
+// checkpoint, so events committed in the meantime are replayed rather than
+// lost.
+func (e *Events) Listen(network *client.Network, chaincodeName string, checkpoint Checkpointer) (stop func(), err error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ccEvents, err := network.ChaincodeEvents(ctx, chaincodeName, client.WithCheckpoint(checkpoint))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	filter := regexp.MustCompile(eventFilter)
+	go func() {
+		for {
+			for ccEvent := range ccEvents {
+				if filter.MatchString(ccEvent.EventName) {
+					e.receive(ccEvent)
+				}
+				err := checkpoint.CheckpointChaincodeEvent(ccEvent)
+				if err != nil {
+					log.Printf("Failed to checkpoint %s event: %v", ccEvent.EventName, err)
+				}
+			}
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(eventRetry):
+				}
+				log.Printf("Reopening chaincode events from block %d", checkpoint.BlockNumber())
+				reopened, err := network.ChaincodeEvents(ctx, chaincodeName, client.WithCheckpoint(checkpoint))
+				if err == nil {
+					ccEvents = reopened
+					break
+				}
+				log.Printf("Failed to reopen chaincode events: %v", err)
+			}
+		}
+	}()
+	return cancel, nil
+}
+
+// receive decodes a chaincode event and publishes it.
+func (e *Events) receive(ccEvent *client.ChaincodeEvent) {
+	event := Event{
+		Name: ccEvent.EventName,
+		TxID: ccEvent.TransactionID,
+	}
+	if len(ccEvent.Payload) > 0 {
+		err := json.Unmarshal(ccEvent.Payload, &event)
+		if err != nil {
+			log.Printf("Failed to decode %s event: %v", ccEvent.EventName, err)
+			return
+		}
+	}
+	e.publish(event)
+}
+
+// logEvents logs every chaincode event the app receives.
+func logEvents(events chan Event) {
+	for event := range events {
+		log.Printf("Chaincode event %s for election %s in tx %s", event.Name, event.ElectionID, event.TxID)
+	}
+}
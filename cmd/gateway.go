@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-gateway/pkg/hash"
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// GatewayConfig says how to reach a peer's Gateway service. The defaults
+// point at peer0 of Org1 in the test network.
+type GatewayConfig struct {
+	// Endpoint is the peer's gRPC target.
+	Endpoint string
+	// ServerName overrides the host name checked against the peer's TLS
+	// certificate, for peers reached through a different address such as
+	// localhost.
+	ServerName string
+	// TLSCertPath is the PEM CA certificate that signed the peer's TLS
+	// certificate. Empty connects without TLS.
+	TLSCertPath string
+	// MSPID is the organization the app's identities belong to.
+	MSPID string
+	// UserMSPDir is the MSP directory of the voter identity the app runs as.
+	UserMSPDir string
+	// AdminMSPDir is the MSP directory of the admin identity used by -seed.
+	AdminMSPDir string
+	// MaintainerMSPDir is the MSP directory of an identity with the
+	// tally-maintainer role, used to compact tallies. Empty turns compaction
+	// off.
+	MaintainerMSPDir string
+}
+
+func gatewayConfigFromEnv() GatewayConfig {
+	return GatewayConfig{
+		Endpoint:         getEnv("PEER_ENDPOINT", "dns:///localhost:7051"),
+		ServerName:       getEnv("PEER_HOST_ALIAS", "peer0.org1.example.com"),
+		TLSCertPath:      getEnv("PEER_TLS_CERT", filepath.Join(testNetworkOrg, "peers", "peer0.org1.example.com", "tls", "ca.crt")),
+		MSPID:            getEnv("MSP_ID", "Org1MSP"),
+		UserMSPDir:       getEnv("USER_MSP_DIR", testNetworkMSP("User1@org1.example.com")),
+		AdminMSPDir:      getEnv("ADMIN_MSP_DIR", testNetworkMSP("Admin@org1.example.com")),
+		MaintainerMSPDir: getEnv("MAINTAINER_MSP_DIR", ""),
+	}
+}
+
+// testNetworkOrg is Org1's crypto material as generated by the test network.
+var testNetworkOrg = filepath.Join("test-network", "organizations", "peerOrganizations", "org1.example.com")
+
+// testNetworkMSP is the MSP directory of one of Org1's test network users.
+func testNetworkMSP(user string) string {
+	return filepath.Join(testNetworkOrg, "users", user, "msp")
+}
+
+// Dial opens the gRPC connection to the peer. It is shared by every gateway
+// connection the app makes, whatever their identity.
+func (c GatewayConfig) Dial() (*grpc.ClientConn, error) {
+	transport := insecure.NewCredentials()
+	if c.TLSCertPath != "" {
+		certPEM, err := os.ReadFile(filepath.Clean(c.TLSCertPath))
+		if err != nil {
+			return nil, err
+		}
+		cert, err := identity.CertificateFromPEM(certPEM)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		pool.AddCert(cert)
+		transport = credentials.NewClientTLSFromCert(pool, c.ServerName)
+	}
+	return grpc.NewClient(c.Endpoint, grpc.WithTransportCredentials(transport))
+}
+
+// Connect opens a gateway on conn acting as the identity in the MSP directory
+// mspDir, which holds signcerts/cert.pem and a single private key in keystore.
+func (c GatewayConfig) Connect(conn *grpc.ClientConn, mspDir string) (*client.Gateway, error) {
+	certPEM, err := os.ReadFile(filepath.Clean(filepath.Join(mspDir, "signcerts", "cert.pem")))
+	if err != nil {
+		return nil, err
+	}
+	cert, err := identity.CertificateFromPEM(certPEM)
+	if err != nil {
+		return nil, err
+	}
+	id, err := identity.NewX509Identity(c.MSPID, cert)
+	if err != nil {
+		return nil, err
+	}
+
+	keyDir := filepath.Join(mspDir, "keystore")
+	// there's a single file in this dir containing the private key
+	files, err := os.ReadDir(keyDir)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) != 1 {
+		return nil, fmt.Errorf("keystore folder should have contain one file")
+	}
+	keyPEM, err := os.ReadFile(filepath.Clean(filepath.Join(keyDir, files[0].Name())))
+	if err != nil {
+		return nil, err
+	}
+	key, err := identity.PrivateKeyFromPEM(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	sign, err := identity.NewPrivateKeySign(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Connect(
+		id,
+		client.WithSign(sign),
+		client.WithHash(hash.SHA256),
+		client.WithClientConnection(conn),
+		client.WithEvaluateTimeout(5*time.Second),
+		client.WithEndorseTimeout(15*time.Second),
+		client.WithSubmitTimeout(5*time.Second),
+		client.WithCommitStatusTimeout(time.Minute),
+	)
+}
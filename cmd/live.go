@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/labstack/echo/v4"
+)
+
+// Results is an election's current standing as shown on the results pages and
+// pushed to live results screens.
+type Results struct {
+	Ballots    int      `json:"ballots"`
+	Counts     []Count  `json:"counts"`
+	Winner     string   `json:"winner,omitempty"`
+	Unrevealed int      `json:"unrevealed,omitempty"`
+	Rounds     []Round  `json:"rounds,omitempty"`
+	Election   Election `json:"-"`
+}
+
+// currentResults tallies the election and redraws images/tally.png. Ranked
+// elections chart their final instant-runoff round. Handlers read results
+// through a ResultsCache rather than calling this directly.
+func currentResults(contract *client.Contract, electionID string) (*Results, error) {
+	election, err := getElection(contract, electionID)
+	if err != nil {
+		return nil, err
+	}
+	candidates, err := listCandidates(contract, electionID)
+	if err != nil {
+		return nil, err
+	}
+	names := candidateNames(candidates)
+
+	results := &Results{Election: *election}
+	if election.BallotType == BallotRanked {
+		ranked, err := tallyRanked(contract, electionID)
+		if err != nil {
+			return nil, err
+		}
+		results.Rounds = rankedRounds(ranked, names)
+		if len(results.Rounds) > 0 {
+			results.Counts = results.Rounds[len(results.Rounds)-1].Counts
+		}
+		if ranked.Winner != "" {
+			results.Winner = candidateName(names, ranked.Winner)
+		}
+	} else {
+		tally, err := tallyVotes(contract, electionID)
+		if err != nil {
+			return nil, err
+		}
+		results.Ballots = tally.Ballots
+		results.Counts = tallyCounts(tally, names)
+		results.Unrevealed = tally.Unrevealed
+	}
+
+	if len(results.Counts) > 0 {
+		// The figures matter more than the picture, so a chart that can't
+		// be drawn leaves the previous one rather than failing the results.
+		err = renderTallyChart(results.Counts)
+		if err != nil {
+			l.Printf("[ERRO] can't render tally chart: %s", err.Error())
+		}
+	}
+	return results, nil
+}
+
+// updatesResults reports whether event can change the election's results.
+func updatesResults(event Event, electionID string) bool {
+	if event.ElectionID != electionID {
+		return false
+	}
+	switch event.Name {
+	case "VoteCast", "ElectionOpened", "ElectionClosed", "CandidateAdded":
+		return true
+	}
+	return false
+}
+
+// streamResults serves Server-Sent Events for the election: a "tally" event
+// with the current Results when the stream opens and again whenever a
+// chaincode event changes them. The chart image is redrawn whenever they are
+// read from the ledger.
+func streamResults(cache *ResultsCache, events *Events, electionID string) echo.HandlerFunc {
+	return func(context echo.Context) error {
+		updates := events.Subscribe()
+		defer events.Unsubscribe(updates)
+
+		response := context.Response()
+		response.Header().Set(echo.HeaderContentType, "text/event-stream")
+		response.Header().Set(echo.HeaderCacheControl, "no-cache")
+		response.Header().Set(echo.HeaderConnection, "keep-alive")
+		response.WriteHeader(200)
+
+		err := sendResults(context, cache, electionID)
+		if err != nil {
+			return err
+		}
+		for {
+			select {
+			case <-context.Request().Context().Done():
+				return nil
+			case event, ok := <-updates:
+				if !ok {
+					return nil
+				}
+				if !updatesResults(event, electionID) {
+					continue
+				}
+				err = sendResults(context, cache, electionID)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// sendResults writes one "tally" event. Results that cannot be read, such as a
+// hidden tally while voting is open, are logged and skipped so the stream
+// stays open until they can.
+func sendResults(context echo.Context, cache *ResultsCache, electionID string) error {
+	results, err := cache.Results(electionID)
+	if err != nil {
+		log.Printf("Failed to refresh results: %v", err)
+		return nil
+	}
+	resultsJSON, err := json.Marshal(results)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(context.Response(), "event: tally\ndata: %s\n\n", resultsJSON)
+	if err != nil {
+		return err
+	}
+	context.Response().Flush()
+	return nil
+}
@@ -1,29 +1,37 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"expvar"
+	"flag"
 	"fmt"
 	"html/template"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/google/uuid"
-	"github.com/hyperledger/fabric-sdk-go/pkg/core/config"
-	"github.com/hyperledger/fabric-sdk-go/pkg/gateway"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
-	"github.com/wcharczuk/go-chart/v2"
+	"google.golang.org/grpc"
 )
 
 var (
 	webAuthn *webauthn.WebAuthn
 
 	datastore PasskeyStore
+	sessions  *Sessions
 	l         Logger
 )
 
@@ -38,11 +46,20 @@ type PasskeyUser interface {
 }
 
 type PasskeyStore interface {
-	GetUser(userName string) PasskeyUser
+	// GetUser looks up a registered user. Users are only created, with
+	// NewUser, once their invitation has been checked.
+	GetUser(userName string) (PasskeyUser, bool)
 	SaveUser(PasskeyUser)
 	GetSession(token string) webauthn.SessionData
 	SaveSession(token string, data webauthn.SessionData)
 	DeleteSession(token string)
+	ExpireSessions(now time.Time) int
+	Stats() StoreStats
+	AddToRoll(electionID string, username string)
+	OnRoll(electionID string, username string) bool
+	SaveInvitation(key string, invitation Invitation)
+	GetInvitation(key string) (Invitation, bool)
+	DeleteInvitation(key string)
 }
 
 type Template struct {
@@ -59,42 +76,15 @@ func (t *Template) Render(w io.Writer, name string, data interface{}, c echo.Con
 	return t.tmpl.ExecuteTemplate(w, name, data)
 }
 
+// Candidate mirrors the chaincode's Candidate asset as returned by
+// ListCandidates.
 type Candidate struct {
-	Name        string
-	Image       string
-	Preselected bool
-	Id          int
-}
-
-func DummyVotingData() *Data[Candidate] {
-	return &Data[Candidate]{
-		Data: []Candidate{
-			{
-				Name:        "Ice Cream",
-				Image:       "https://tb-static.uber.com/prod/image-proc/processed_images/d9782f5be876bced7b8ad068ad0d38f7/16bb0a3ab8ea98cfe8906135767f7bf4.webp",
-				Preselected: false,
-				Id:          1,
-			},
-			{
-				Name:        "Pizza",
-				Image:       "https://imgs.search.brave.com/RA2aE_owg_BIacd3RIATkWqz-R2KH2P0fBD-aciBBAo/rs:fit:860:0:0/g:ce/aHR0cHM6Ly90My5m/dGNkbi5uZXQvanBn/LzAwLzU3Lzg0Lzkw/LzM2MF9GXzU3ODQ5/MDgyX1RaYTdxOGxJ/UktYQ2dKcXNpdTRw/MDlwbU44RmtQMklp/LmpwZw",
-				Preselected: false,
-				Id:          2,
-			},
-			{
-				Name:        "Hot Dogs",
-				Image:       "https://imgs.search.brave.com/mXX8oOIOqHKKJ5C3VCXNJqZazcShGQ-7F7_jLl47j1A/rs:fit:860:0:0/g:ce/aHR0cHM6Ly9tZWRp/YS5pc3RvY2twaG90/by5jb20vaWQvMTg1/MTIzMzc3L3Bob3Rv/L2hvdGRvZy5qcGc_/cz02MTJ4NjEyJnc9/MCZrPTIwJmM9d0N2/eFhkTVh6bWtSM2VE/T0hlaWZuZW5IRFMx/b3dDNWIyTnRpSzdi/TzlVOD0",
-				Preselected: false,
-				Id:          3,
-			},
-			{
-				Name:        "Salad",
-				Image:       "https://imgs.search.brave.com/Y3n3r0lsFhLdzFcj0eTd_YCeq9ojvZWB_QwRWs17EZ4/rs:fit:860:0:0/g:ce/aHR0cHM6Ly93d3cu/aGF1dGVhbmRoZWFs/dGh5bGl2aW5nLmNv/bS93cC1jb250ZW50/L3VwbG9hZHMvMjAy/MS8xMC9MZW50aWwt/VGFiYm91bGVoLVNh/bGFkLTEwLmpwZw",
-				Preselected: false,
-				Id:          4,
-			},
-		},
-	}
+	ID          string `json:"id"`
+	ElectionID  string `json:"electionId"`
+	Name        string `json:"name"`
+	Image       string `json:"image"`
+	Description string `json:"description"`
+	Withdrawn   bool   `json:"withdrawn"`
 }
 
 func DummyResultsData() *Data[Result] {
@@ -200,42 +190,28 @@ func ResultsData(data Data[Result], form FormData) PageData[Result] {
 	}
 }
 func main() {
+	seed := flag.Bool("seed", false, "seed an empty ledger with demo data (demo mode)")
+	fixturePath := flag.String("fixture", filepath.Join("fixtures", "seed.json"), "JSON fixture used by -seed")
+	rollPath := flag.String("roll", "", "CSV of usernames to add to the election's voter roll, logging an invitation link for each")
+	passkeysPath := flag.String("passkeys", "passkeys.db", "bbolt file storing registered passkeys, empty to keep them in memory")
+	checkpointPath := flag.String("checkpoint", "events.checkpoint", "file recording the last chaincode event handled, empty to only hear new events")
+	voterSecretPath := flag.String("voter-secret", "voter.secret", "file holding the secret that keys voter pseudonyms, created if missing; VOTER_SECRET overrides it")
+	compactInterval := flag.Duration("compact", time.Minute, "how often to compact the tallies of elections with new votes when MAINTAINER_MSP_DIR is set, 0 to never")
+	flag.Parse()
+
 	l = log.Default()
 
 	log.Println("============ application-golang starts ============")
 
-	err := os.Setenv("DISCOVERY_AS_LOCALHOST", "true")
-	if err != nil {
-		log.Fatalf("Error setting DISCOVERY_AS_LOCALHOST environment variable: %v", err)
-	}
-
-	walletPath := "wallet"
-	// remove any existing wallet from prior runs
-	os.RemoveAll(walletPath)
-	wallet, err := gateway.NewFileSystemWallet(walletPath)
+	gatewayConfig := gatewayConfigFromEnv()
+	log.Println("--> Connecting to peer gateway", gatewayConfig.Endpoint)
+	conn, err := gatewayConfig.Dial()
 	if err != nil {
-		log.Fatalf("Failed to create wallet: %v", err)
+		log.Fatalf("Failed to connect to peer: %v", err)
 	}
+	defer conn.Close()
 
-	if !wallet.Exists("appUser") {
-		err = populateWallet(wallet)
-		if err != nil {
-			log.Fatalf("Failed to populate wallet contents: %v", err)
-		}
-	}
-
-	ccpPath := filepath.Join(
-		"test-network",
-		"organizations",
-		"peerOrganizations",
-		"org1.example.com",
-		"connection-org1.yaml",
-	)
-
-	gw, err := gateway.Connect(
-		gateway.WithConfig(config.FromFile(filepath.Clean(ccpPath))),
-		gateway.WithIdentity(wallet, "appUser"),
-	)
+	gw, err := gatewayConfig.Connect(conn, gatewayConfig.UserMSPDir)
 	if err != nil {
 		log.Fatalf("Failed to connect to gateway: %v", err)
 	}
@@ -247,10 +223,7 @@ func main() {
 	}
 
 	log.Println("--> Connecting to channel", channelName)
-	network, err := gw.GetNetwork(channelName)
-	if err != nil {
-		log.Fatalf("Failed to get network: %v", err)
-	}
+	network := gw.GetNetwork(channelName)
 
 	chaincodeName := "vote"
 	if ccname := os.Getenv("CHAINCODE_NAME"); ccname != "" {
@@ -260,11 +233,46 @@ func main() {
 	log.Println("--> Using chaincode", chaincodeName)
 	contract := network.GetContract(chaincodeName)
 
-	result, err := contract.SubmitTransaction("InitLedger")
+	electionID := getEnv("ELECTION_ID", "lunch")
+	log.Println("--> Using election", electionID)
+
+	if *seed {
+		err = seedLedger(gatewayConfig, conn, channelName, chaincodeName, *fixturePath)
+		if err != nil {
+			log.Fatalf("Failed to seed ledger: %v", err)
+		}
+	}
+
+	checkpoint, err := newCheckpointer(*checkpointPath)
 	if err != nil {
-		log.Fatalf("Failed to Submit transaction: %v", err)
+		log.Fatalf("Failed to open event checkpoint: %v", err)
+	}
+	defer func() {
+		err := checkpoint.Close()
+		if err != nil {
+			log.Printf("Failed to close event checkpoint: %v", err)
+		}
+	}()
+	events := NewEvents()
+	stopEvents, err := events.Listen(network, chaincodeName, checkpoint)
+	if err != nil {
+		log.Fatalf("Failed to register for chaincode events: %v", err)
+	}
+	defer stopEvents()
+	go logEvents(events.Subscribe())
+	resultsCache := NewResultsCache(contract, events)
+
+	if *compactInterval > 0 && gatewayConfig.MaintainerMSPDir != "" {
+		maintainerGw, err := gatewayConfig.Connect(conn, gatewayConfig.MaintainerMSPDir)
+		if err != nil {
+			log.Fatalf("Failed to connect to gateway as tally maintainer: %v", err)
+		}
+		defer maintainerGw.Close()
+		stopCompactor := startCompactor(*compactInterval, l, maintainerGw.GetNetwork(channelName).GetContract(chaincodeName), events)
+		defer stopCompactor()
+	} else {
+		log.Println("--> Tally compaction off, set MAINTAINER_MSP_DIR to enable it")
 	}
-	log.Println(string(result))
 
 	proto := getEnv("PROTO", "http")
 	host := getEnv("HOST", "localhost")
@@ -286,23 +294,69 @@ func main() {
 	}
 
 	l.Printf("[INFO] create datastore")
-	datastore = NewInMem(l)
+	if *passkeysPath == "" {
+		datastore = NewInMem(l)
+	} else {
+		store, err := NewBolt(*passkeysPath, l)
+		if err != nil {
+			log.Fatalf("Failed to open passkey store: %v", err)
+		}
+		defer store.Close()
+		datastore = store
+	}
+	secret, err := sessionSecret()
+	if err != nil {
+		log.Fatalf("Failed to create session secret: %v", err)
+	}
+	sessions = NewSessions(secret)
+	voterKey, err := voterSecret(*voterSecretPath)
+	if err != nil {
+		log.Fatalf("Failed to read voter secret: %v", err)
+	}
+	pseudonyms := NewPseudonyms(voterKey)
+
+	if *rollPath != "" {
+		err = importRollFile(datastore, electionID, *rollPath)
+		if err != nil {
+			log.Fatalf("Failed to import voter roll: %v", err)
+		}
+	}
+
+	stopJanitor := startJanitor(time.Minute, l, datastore, sessions)
+	defer stopJanitor()
+	expvar.Publish("passkeyStore", expvar.Func(func() interface{} {
+		return datastore.Stats()
+	}))
 
 	e := echo.New()
 	e.Static("/images", "images")
 	e.Renderer = newTemplate()
+	e.HTTPErrorHandler = errorHandler
 	e.Use(middleware.Logger())
+	authed := e.Group("", requireLogin(sessions))
+	admin := e.Group("/admin", requireLogin(sessions), requireAdmin(strings.Split(getEnv("ADMIN_USERS", ""), ",")))
+
+	admin.GET("/debug/vars", echo.WrapHandler(expvar.Handler()))
 
 	e.GET("/", func(context echo.Context) error {
 		return context.Render(200, "index.html", NewFormData())
 	})
 
-	e.POST("/login", func(context echo.Context) error {
-		data := DummyVotingData()
-		return context.Render(200, "voting", VotingData(*data, NewFormData()))
+	authed.POST("/login", func(context echo.Context) error {
+		election, err := getElection(contract, electionID)
+		if err != nil {
+			return err
+		}
+		candidates, err := listCandidates(contract, electionID)
+		if err != nil {
+			return err
+		}
+		form := ballotForm(election)
+		return context.Render(200, ballotTemplate(election), VotingData(BallotData(candidates), form))
 	})
 
 	e.GET("/logout", func(context echo.Context) error {
+		sessions.Logout(context)
 		return context.Render(200, "logout", NewFormData())
 	})
 
@@ -319,88 +373,211 @@ func main() {
 
 	e.POST("loginFinish", FinishLogin)
 
-	e.GET("/settings", func(context echo.Context) error {
+	authed.GET("/settings", func(context echo.Context) error {
 		data := DummySettingsData()
 		return context.Render(200, "settings", SettingsData(*data, NewFormData()))
 	})
 
-	e.POST("/vote", func(context echo.Context) error {
-		id := context.FormValue("preselect")
-		result, err := contract.SubmitTransaction("AddVote", id)
+	authed.POST("/vote", func(context echo.Context) error {
+		election, err := getElection(contract, electionID)
 		if err != nil {
-			log.Fatalf("Failed to Submit transaction: %v", err)
+			return err
+		}
+		candidates, err := listCandidates(contract, electionID)
+		if err != nil {
+			return err
+		}
+		receipt, code, err := castBallot(context, contract, election, candidates, pseudonyms.Voter(electionID, sessionUsername(context)))
+		if err != nil {
+			appErr := classifyError(err)
+			switch appErr.Kind {
+			case ErrAlreadyVoted:
+				return context.Render(200, "already-voted", NewFormData())
+			case ErrValidation, ErrConflict:
+				form := ballotForm(election)
+				form.Errors["ballot"] = appErr.Message
+				return context.Render(200, ballotTemplate(election), VotingData(BallotData(candidates), form))
+			}
+			return appErr
+		}
+		if election.CommitReveal {
+			form := NewFormData()
+			form.Values["code"] = code
+			return context.Render(200, "committed", form)
 		}
-		log.Println(string(result))
-		return context.Render(200, "voted", NewFormData())
+		return context.Render(200, "voted", receiptForm(receipt))
+	}, requireRoll(datastore, electionID))
+
+	authed.GET("/reveal", func(context echo.Context) error {
+		return context.Render(200, "reveal", NewFormData())
 	})
 
-	e.GET("/results", func(context echo.Context) error {
-		tallyJSON, err := contract.SubmitTransaction("TallyVotes")
+	authed.POST("/reveal", func(context echo.Context) error {
+		receipt, err := revealBallot(contract, electionID, context.FormValue("code"))
 		if err != nil {
-			log.Fatalf("Failed to Submit transaction: %v", err)
+			appErr := classifyError(err)
+			switch appErr.Kind {
+			case ErrValidation, ErrConflict:
+				form := NewFormData()
+				form.Errors["ballot"] = appErr.Message
+				return context.Render(200, "reveal", form)
+			}
+			return appErr
 		}
+		return context.Render(200, "voted", receiptForm(receipt))
+	})
+
+	e.GET("/verify", func(context echo.Context) error {
+		form := NewFormData()
+		form.Values["voteId"] = context.QueryParam("voteId")
+		form.Values["ballotHash"] = context.QueryParam("ballotHash")
+		return context.Render(200, "verify.html", form)
+	})
 
-		tally := map[string]int{}
-		err = json.Unmarshal(tallyJSON, &tally)
+	e.POST("/verify", func(context echo.Context) error {
+		form := NewFormData()
+		form.Values["voteId"] = strings.TrimSpace(context.FormValue("voteId"))
+		form.Values["ballotHash"] = strings.TrimSpace(context.FormValue("ballotHash"))
+		verified, err := verifyReceipt(contract, electionID, form.Values["voteId"], form.Values["ballotHash"])
 		if err != nil {
-			fmt.Println(err)
 			return err
 		}
+		if verified {
+			form.Values["verified"] = "true"
+		}
+		return context.Render(200, "verify-result", form)
+	})
 
-		values := []chart.Value{}
-		for label, count := range tally {
-			value := chart.Value{
-				Label: label,
-				Value: float64(count),
-			}
-			values = append(values, value)
+	authed.GET("/results", func(context echo.Context) error {
+		results, err := resultsCache.Results(electionID)
+		if err != nil {
+			return err
 		}
 
-		bar := chart.BarChart{
-			Title: "Results",
-			Background: chart.Style{
-				Padding: chart.Box{
-					Top: 30,
-				},
-			},
-			Height:   256,
-			BarWidth: 50,
-			Bars:     values,
+		form := NewFormData()
+		if results.Winner != "" {
+			form.Values["winner"] = results.Winner
+		}
+		if results.Unrevealed > 0 {
+			form.Values["unrevealed"] = strconv.Itoa(results.Unrevealed)
 		}
+		if results.Election.BallotType == BallotRanked {
+			return context.Render(200, "ranked-results", PageData[Round]{
+				Data: Data[Round]{Data: results.Rounds},
+				Form: form,
+			})
+		}
+		data := DummyResultsData()
+		return context.Render(200, "results", ResultsData(*data, form))
+	})
+
+	authed.GET("/results/stream", streamResults(resultsCache, events, electionID))
 
-		f, err := os.Create("images/tally.png")
+	admin.GET("/audit", func(context echo.Context) error {
+		return context.Render(200, "admin.html", PageData[Option]{
+			Data: Data[Option]{Data: auditRecords},
+			Form: NewFormData(),
+		})
+	})
+
+	admin.POST("/roll", func(context echo.Context) error {
+		form := NewFormData()
+		file, err := context.FormFile("roll")
+		if err != nil {
+			form.Errors["roll"] = "choose a CSV file of usernames"
+			return context.Render(200, "roll-invitations", PageData[InvitationLink]{Form: form})
+		}
+		csvFile, err := file.Open()
 		if err != nil {
 			return err
 		}
-		defer f.Close()
+		defer csvFile.Close()
+		links, err := importRoll(datastore, electionID, csvFile)
+		if err != nil {
+			form.Errors["roll"] = fmt.Sprintf("can't read roll: %s", err.Error())
+		}
+		return context.Render(200, "roll-invitations", PageData[InvitationLink]{
+			Data: Data[InvitationLink]{Data: links},
+			Form: form,
+		})
+	})
 
-		buffer := bytes.NewBuffer([]byte{})
-		err = bar.Render(chart.PNG, buffer)
+	admin.GET("/votes", func(context echo.Context) error {
+		page, err := queryVotes(contract, electionID, context.QueryParam("bookmark"))
 		if err != nil {
-			fmt.Println(err)
 			return err
 		}
+		form := NewFormData()
+		form.Values["bookmark"] = page.Bookmark
+		form.Values["fetched"] = strconv.Itoa(int(page.FetchedCount))
+		return context.Render(200, "vote-page", PageData[Vote]{
+			Data: Data[Vote]{Data: page.Votes},
+			Form: form,
+		})
+	})
 
-		buffer.WriteTo(f)
-
-		fmt.Println("Bar chart created successfully!")
-		data := DummyResultsData()
-		return context.Render(200, "results", ResultsData(*data, NewFormData()))
+	admin.GET("/audit/history", func(context echo.Context) error {
+		record := context.QueryParam("record")
+		id := context.QueryParam("id")
+		form := NewFormData()
+		form.Values["record"] = record
+		form.Values["id"] = id
+		history, err := keyHistory(contract, electionID, record, id)
+		if err != nil {
+			return err
+		}
+		return context.Render(200, "audit-history", PageData[HistoryEntry]{
+			Data: Data[HistoryEntry]{Data: history},
+			Form: form,
+		})
 	})
 
-	e.Logger.Fatal(e.Start(port))
+	// Shut down on SIGINT or SIGTERM by returning from main, so the deferred
+	// cleanup above runs: the event stream stops before its checkpoint is
+	// closed, and the passkey store and gateway connections are released.
+	stop, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	go func() {
+		err := e.Start(port)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Server stopped: %v", err)
+		}
+		cancel()
+	}()
+	<-stop.Done()
+	log.Println("============ application-golang stops ============")
+	shutdown, cancelShutdown := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelShutdown()
+	err = e.Shutdown(shutdown)
+	if err != nil {
+		log.Printf("Failed to shut down server: %v", err)
+	}
 }
 
 func BeginRegistration(context echo.Context) error {
 	l.Printf("[INFO] begin registration ----------------------\\")
 
-	username, err := getUsername(context.Request())
+	var request struct {
+		Username   string `json:"username"`
+		Invitation string `json:"invitation"`
+	}
+	err := json.NewDecoder(context.Request().Body).Decode(&request)
 	if err != nil {
 		l.Printf("[ERRO]can't get user name: %s", err.Error())
-		panic(err)
+		return context.JSON(http.StatusBadRequest, "can't get user name")
+	}
+	username := normalizeUsername(request.Username)
+
+	err = checkInvitation(datastore, request.Invitation, username)
+	if err != nil {
+		l.Printf("[WARN] refusing registration for %s: %s", username, err.Error())
+		return context.JSON(http.StatusForbidden, err.Error())
 	}
 
-	user := datastore.GetUser(username) // Find or create the new user
+	user, ok := datastore.GetUser(username) // Find or create the new user
+	if !ok {
+		user = NewUser(username)
+	}
 
 	options, session, err := webAuthn.BeginRegistration(user)
 	if err != nil {
@@ -421,7 +598,18 @@ func FinishRegistration(context echo.Context) error {
 	sessionKey := context.Request().Header.Get("Session-Key")
 	session := datastore.GetSession(sessionKey)
 
-	user := datastore.GetUser(string(session.UserID)) // Get the user
+	username := string(session.UserID)
+
+	invitation := context.Request().Header.Get("Invitation")
+	err := checkInvitation(datastore, invitation, username)
+	if err != nil {
+		return context.JSON(http.StatusForbidden, err.Error())
+	}
+
+	user, ok := datastore.GetUser(username) // Get the user
+	if !ok {
+		user = NewUser(username)
+	}
 
 	credential, err := webAuthn.FinishRegistration(user, session, context.Request())
 	if err != nil {
@@ -433,6 +621,7 @@ func FinishRegistration(context echo.Context) error {
 	user.AddCredential(credential)
 	datastore.SaveUser(user)
 	datastore.DeleteSession(sessionKey)
+	datastore.DeleteInvitation(invitationKey(invitation))
 
 	l.Printf("[INFO] finish registration ----------------------/")
 	return context.JSON(200, "Registration Success")
@@ -444,10 +633,13 @@ func BeginLogin(context echo.Context) error {
 	username, err := getUsername(context.Request())
 	if err != nil {
 		l.Printf("[ERRO]can't get user name: %s", err.Error())
-		panic(err)
+		return context.JSON(http.StatusBadRequest, "can't get user name")
 	}
 
-	user := datastore.GetUser(username) // Find the user
+	user, ok := datastore.GetUser(normalizeUsername(username)) // Find the user
+	if !ok {
+		return context.JSON(http.StatusBadRequest, "can't begin login: no passkey is registered for that username")
+	}
 
 	options, session, err := webAuthn.BeginLogin(user)
 	if err != nil {
@@ -469,13 +661,20 @@ func FinishLogin(context echo.Context) error {
 	sessionKey := context.Request().Header.Get("Session-Key")
 	l.Printf("[sessionKey] " + sessionKey)
 
-	session := datastore.GetSession(sessionKey)       // FIXME: cover invalid session
-	user := datastore.GetUser(string(session.UserID)) // Get the user
+	session := datastore.GetSession(sessionKey)
+	if len(session.UserID) == 0 {
+		return context.JSON(http.StatusBadRequest, "login session expired")
+	}
+	user, ok := datastore.GetUser(string(session.UserID)) // Get the user
+	if !ok {
+		return context.JSON(http.StatusBadRequest, "can't finish login: unknown user")
+	}
 
 	credential, err := webAuthn.FinishLogin(user, session, context.Request())
 	if err != nil {
-		l.Printf("[ERRO] can't finish login %s", err.Error())
-		panic(err)
+		msg := fmt.Sprintf("can't finish login: %s", err.Error())
+		l.Printf("[ERRO] %s", msg)
+		return context.JSON(http.StatusBadRequest, msg)
 	}
 
 	if credential.Authenticator.CloneWarning {
@@ -485,6 +684,7 @@ func FinishLogin(context echo.Context) error {
 	user.UpdateCredential(credential)
 	datastore.SaveUser(user)
 	datastore.DeleteSession(sessionKey)
+	sessions.Login(context, user.WebAuthnName())
 
 	l.Printf("[INFO] finish login ----------------------/")
 	return context.JSON(200, "Login finished")
@@ -502,6 +702,26 @@ func getUsername(r *http.Request) (string, error) {
 	return u.Username, nil
 }
 
+// BallotData holds the candidates still standing, in registry order.
+func BallotData(candidates []Candidate) Data[Candidate] {
+	data := Data[Candidate]{}
+	for _, candidate := range candidates {
+		if !candidate.Withdrawn {
+			data.Data = append(data.Data, candidate)
+		}
+	}
+	return data
+}
+
+func listCandidates(contract *client.Contract, electionID string) ([]Candidate, error) {
+	var candidates []Candidate
+	err := evaluate(contract, &candidates, "ListCandidates", electionID)
+	if err != nil {
+		return nil, err
+	}
+	return candidates, nil
+}
+
 func getEnv(key, def string) string {
 	if value, exists := os.LookupEnv(key); exists {
 		return value
@@ -509,41 +729,26 @@ func getEnv(key, def string) string {
 	return def
 }
 
-func populateWallet(wallet *gateway.Wallet) error {
-	log.Println("============ Populating wallet ============")
-	credPath := filepath.Join(
-		"test-network",
-		"organizations",
-		"peerOrganizations",
-		"org1.example.com",
-		"users",
-		"User1@org1.example.com",
-		"msp",
-	)
-
-	certPath := filepath.Join(credPath, "signcerts", "cert.pem")
-	// read the certificate pem
-	cert, err := os.ReadFile(filepath.Clean(certPath))
+// seedLedger submits InitLedger with the fixture as the org admin, since
+// seeding is restricted to election admins and the app otherwise runs as a
+// voter. The chaincode refuses to seed a ledger that already holds elections.
+func seedLedger(gatewayConfig GatewayConfig, conn *grpc.ClientConn, channelName, chaincodeName, fixturePath string) error {
+	log.Println("============ Seeding ledger ============")
+	fixture, err := os.ReadFile(filepath.Clean(fixturePath))
 	if err != nil {
 		return err
 	}
 
-	keyDir := filepath.Join(credPath, "keystore")
-	// there's a single file in this dir containing the private key
-	files, err := os.ReadDir(keyDir)
+	gw, err := gatewayConfig.Connect(conn, gatewayConfig.AdminMSPDir)
 	if err != nil {
 		return err
 	}
-	if len(files) != 1 {
-		return fmt.Errorf("keystore folder should have contain one file")
-	}
-	keyPath := filepath.Join(keyDir, files[0].Name())
-	key, err := os.ReadFile(filepath.Clean(keyPath))
+	defer gw.Close()
+
+	result, err := gw.GetNetwork(channelName).GetContract(chaincodeName).SubmitTransaction("InitLedger", string(fixture))
 	if err != nil {
 		return err
 	}
-
-	identity := gateway.NewX509Identity("Org1MSP", string(cert), string(key))
-
-	return wallet.Put("appUser", identity)
+	log.Println(string(result))
+	return nil
 }
@@ -10,6 +10,27 @@ type User struct {
 	creds []webauthn.Credential
 }
 
+// NewUser returns a user with no passkeys yet. It is only stored once
+// registration succeeds.
+func NewUser(userName string) *User {
+	return &User{
+		ID:          []byte(userName),
+		DisplayName: userName,
+		Name:        userName,
+	}
+}
+
+// copyUser returns a User holding copies of user's fields, so the copy can be
+// changed without affecting user.
+func copyUser(user PasskeyUser) *User {
+	return &User{
+		ID:          append([]byte(nil), user.WebAuthnID()...),
+		DisplayName: user.WebAuthnDisplayName(),
+		Name:        user.WebAuthnName(),
+		creds:       append([]webauthn.Credential(nil), user.WebAuthnCredentials()...),
+	}
+}
+
 func (o *User) WebAuthnID() []byte {
 	return o.ID
 }
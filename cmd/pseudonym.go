@@ -0,0 +1,57 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Pseudonyms turns usernames into the voter pseudonyms passed to the
+// chaincode. The chaincode hashes the pseudonym into its voted marker without
+// a secret of its own, so a bare username could be recovered from the ledger
+// by hashing every likely one. Keying the pseudonym with a secret only the app
+// holds prevents that, and including the election ID means a voter's markers
+// in different elections can't be linked.
+type Pseudonyms struct {
+	secret []byte
+}
+
+func NewPseudonyms(secret []byte) *Pseudonyms {
+	return &Pseudonyms{secret: secret}
+}
+
+// Voter returns the username's pseudonym in the election: the hex HMAC-SHA256
+// of the election ID and username.
+func (p *Pseudonyms) Voter(electionID, username string) string {
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write([]byte(electionID + "|" + username))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// voterSecret reads VOTER_SECRET, or else the secret kept in the file at path,
+// creating it on first use. Unlike the session secret it must never change
+// while an election is open, or every voter would get a new pseudonym and
+// could vote again.
+func voterSecret(path string) ([]byte, error) {
+	if secret := getEnv("VOTER_SECRET", ""); secret != "" {
+		return []byte(secret), nil
+	}
+	secret, err := os.ReadFile(filepath.Clean(path))
+	if err == nil {
+		return secret, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	secret = make([]byte, 32)
+	_, err = rand.Read(secret)
+	if err != nil {
+		return nil, err
+	}
+	return secret, os.WriteFile(path, secret, 0600)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+// resultsTTL bounds how long cached results are served without an event
+// saying they changed, in case the event was missed.
+const resultsTTL = 30 * time.Second
+
+// evaluate calls a read-only chaincode function and decodes its JSON result
+// into result, leaving result as it is when the function returns nothing.
+// Evaluating asks one peer and never reaches the orderer, so
+// reads neither add a block to the ledger nor wait for one to be cut.
+// Anything that writes state has to be submitted instead, or the write is
+// silently dropped.
+func evaluate(contract *client.Contract, result interface{}, function string, args ...string) error {
+	resultJSON, err := contract.EvaluateTransaction(function, args...)
+	if err != nil {
+		return err
+	}
+	if len(resultJSON) == 0 {
+		return nil
+	}
+	return json.Unmarshal(resultJSON, result)
+}
+
+func tallyVotes(contract *client.Contract, electionID string) (*Tally, error) {
+	var tally Tally
+	err := evaluate(contract, &tally, "TallyVotes", electionID)
+	if err != nil {
+		return nil, err
+	}
+	return &tally, nil
+}
+
+// ResultsCache keeps each election's current Results for up to resultsTTL so
+// results pages and live screens don't query the peer on every view. Every
+// chaincode event the app listens for drops its election's entry, since votes,
+// status changes and new candidates all change the results.
+type ResultsCache struct {
+	contract *client.Contract
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*resultsEntry
+}
+
+// resultsEntry is locked while its results are read so that a burst of
+// requests after an event queries the peer once.
+type resultsEntry struct {
+	mu      sync.Mutex
+	results *Results
+	expires time.Time
+}
+
+// NewResultsCache returns a cache reading from contract and invalidated by
+// events.
+func NewResultsCache(contract *client.Contract, events *Events) *ResultsCache {
+	cache := &ResultsCache{
+		contract: contract,
+		ttl:      resultsTTL,
+		entries:  map[string]*resultsEntry{},
+	}
+	events.Hook(func(event Event) {
+		cache.Invalidate(event.ElectionID)
+	})
+	return cache
+}
+
+// Results returns the election's current results, from the cache if they are
+// fresh. The Results are shared and must not be modified.
+func (c *ResultsCache) Results(electionID string) (*Results, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[electionID]
+	if !ok {
+		entry = &resultsEntry{}
+		c.entries[electionID] = entry
+	}
+	c.mu.Unlock()
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	now := time.Now()
+	if entry.results != nil && now.Before(entry.expires) {
+		return entry.results, nil
+	}
+	results, err := currentResults(c.contract, electionID)
+	if err != nil {
+		return nil, err
+	}
+	entry.results = results
+	entry.expires = now.Add(c.ttl)
+	return results, nil
+}
+
+// Invalidate drops the election's cached results. A read already under way
+// finishes into the dropped entry, so only requests that started before the
+// change can see its result.
+func (c *ResultsCache) Invalidate(electionID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, electionID)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+// Receipt mirrors the chaincode's Receipt, returned when a ballot is
+// recorded.
+type Receipt struct {
+	TxID       string `json:"txId"`
+	ElectionID string `json:"electionId"`
+	VoteID     string `json:"voteId"`
+	BallotHash string `json:"ballotHash"`
+}
+
+func parseReceipt(receiptJSON []byte) (*Receipt, error) {
+	var receipt Receipt
+	err := json.Unmarshal(receiptJSON, &receipt)
+	if err != nil {
+		return nil, err
+	}
+	return &receipt, nil
+}
+
+// receiptForm fills the voted template's values from the receipt.
+func receiptForm(receipt *Receipt) FormData {
+	form := NewFormData()
+	form.Values["txId"] = receipt.TxID
+	form.Values["electionId"] = receipt.ElectionID
+	form.Values["voteId"] = receipt.VoteID
+	form.Values["ballotHash"] = receipt.BallotHash
+	return form
+}
+
+func verifyReceipt(contract *client.Contract, electionID string, voteID string, ballotHash string) (bool, error) {
+	if voteID == "" || ballotHash == "" {
+		return false, nil
+	}
+	var verified bool
+	err := evaluate(contract, &verified, "VerifyReceipt", electionID, voteID, ballotHash)
+	if err != nil {
+		return false, err
+	}
+	return verified, nil
+}
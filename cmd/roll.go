@@ -0,0 +1,126 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// invitationTTL is how long an invitation can be used to register.
+const invitationTTL = 7 * 24 * time.Hour
+
+// Invitation lets one voter on an election's roll register a passkey. It is
+// stored under the hash of its token, and deleted once used.
+type Invitation struct {
+	ElectionID string    `json:"electionId"`
+	Username   string    `json:"username"`
+	Expires    time.Time `json:"expires"`
+}
+
+// InvitationLink is an invitation as shown to the admin who issued it; the
+// token itself is never stored.
+type InvitationLink struct {
+	Username string
+	Link     string
+}
+
+var errNotInvited = errors.New("username is not on the voter roll or the invitation is invalid")
+
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+func invitationKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// importRoll adds every username in the first column of the CSV to the
+// election's roll and issues each an invitation. A header row naming the
+// column "username" or "email" is skipped.
+func importRoll(store PasskeyStore, electionID string, r io.Reader) ([]InvitationLink, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	links := []InvitationLink{}
+	for row := 0; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		username := normalizeUsername(record[0])
+		if username == "" || (row == 0 && (username == "username" || username == "email")) {
+			continue
+		}
+		store.AddToRoll(electionID, username)
+		token, err := invite(store, electionID, username)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, InvitationLink{
+			Username: username,
+			Link:     "/?invite=" + token,
+		})
+	}
+	return links, nil
+}
+
+// invite issues a new one-time invitation token for a voter on the roll.
+func invite(store PasskeyStore, electionID string, username string) (string, error) {
+	tokenBytes := make([]byte, 24)
+	_, err := rand.Read(tokenBytes)
+	if err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(tokenBytes)
+	store.SaveInvitation(invitationKey(token), Invitation{
+		ElectionID: electionID,
+		Username:   username,
+		Expires:    time.Now().Add(invitationTTL),
+	})
+	return token, nil
+}
+
+// checkInvitation returns errNotInvited unless token is an unexpired
+// invitation for username, who is still on the invitation's roll.
+func checkInvitation(store PasskeyStore, token string, username string) error {
+	if token == "" {
+		return errNotInvited
+	}
+	invitation, ok := store.GetInvitation(invitationKey(token))
+	if !ok || invitation.Username != normalizeUsername(username) || !time.Now().Before(invitation.Expires) {
+		return errNotInvited
+	}
+	if !store.OnRoll(invitation.ElectionID, invitation.Username) {
+		return errNotInvited
+	}
+	return nil
+}
+
+// importRollFile imports the CSV at path with importRoll and logs each
+// voter's invitation link for the admin to pass on.
+func importRollFile(store PasskeyStore, electionID string, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	links, err := importRoll(store, electionID, f)
+	if err != nil {
+		return err
+	}
+	for _, link := range links {
+		log.Printf("--> Invitation for %s: %s", link.Username, link.Link)
+	}
+	return nil
+}
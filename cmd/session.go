@@ -0,0 +1,209 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	sessionCookie = "session"
+	loginTTL      = 12 * time.Hour
+
+	// usernameKey is where requireLogin leaves the logged-in username on the
+	// echo context.
+	usernameKey = "username"
+)
+
+type loginSession struct {
+	username string
+	expires  time.Time
+}
+
+// Sessions tracks logged-in users. The cookie only carries a random session
+// ID signed with secret, so logging out or expiring a session server-side
+// ends it even if the browser still holds the cookie.
+type Sessions struct {
+	mu       sync.Mutex
+	secret   []byte
+	sessions map[string]loginSession
+}
+
+func NewSessions(secret []byte) *Sessions {
+	return &Sessions{
+		secret:   secret,
+		sessions: map[string]loginSession{},
+	}
+}
+
+// sessionSecret reads SESSION_SECRET, or makes a random secret when it is
+// unset, in which case sessions end when the app restarts.
+func sessionSecret() ([]byte, error) {
+	if secret := getEnv("SESSION_SECRET", ""); secret != "" {
+		return []byte(secret), nil
+	}
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+func (s *Sessions) sign(id string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(id))
+	return id + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verify returns the session ID in a signed cookie value.
+func (s *Sessions) verify(value string) (string, bool) {
+	id, _, ok := strings.Cut(value, ".")
+	if !ok || !hmac.Equal([]byte(s.sign(id)), []byte(value)) {
+		return "", false
+	}
+	return id, true
+}
+
+// Login starts a session for username and sets its cookie.
+func (s *Sessions) Login(context echo.Context, username string) {
+	id := uuid.New().String()
+	expires := time.Now().Add(loginTTL)
+	s.mu.Lock()
+	s.sessions[id] = loginSession{
+		username: username,
+		expires:  expires,
+	}
+	s.mu.Unlock()
+	context.SetCookie(&http.Cookie{
+		Name:     sessionCookie,
+		Value:    s.sign(id),
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   context.IsTLS(),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Logout ends the request's session, if any, and clears its cookie.
+func (s *Sessions) Logout(context echo.Context) {
+	if cookie, err := context.Cookie(sessionCookie); err == nil {
+		if id, ok := s.verify(cookie.Value); ok {
+			s.mu.Lock()
+			delete(s.sessions, id)
+			s.mu.Unlock()
+		}
+	}
+	context.SetCookie(&http.Cookie{
+		Name:     sessionCookie,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   context.IsTLS(),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Username returns the user logged in to the request's session.
+func (s *Sessions) Username(context echo.Context) (string, bool) {
+	cookie, err := context.Cookie(sessionCookie)
+	if err != nil {
+		return "", false
+	}
+	id, ok := s.verify(cookie.Value)
+	if !ok {
+		return "", false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok {
+		return "", false
+	}
+	if !time.Now().Before(session.expires) {
+		delete(s.sessions, id)
+		return "", false
+	}
+	return session.username, true
+}
+
+// ExpireSessions drops sessions that expired by now and returns how many.
+func (s *Sessions) ExpireSessions(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expired := 0
+	for id, session := range s.sessions {
+		if !now.Before(session.expires) {
+			delete(s.sessions, id)
+			expired++
+		}
+	}
+	return expired
+}
+
+// requireLogin rejects requests without a valid session and otherwise stores
+// the username under usernameKey. htmx requests are sent back to the login
+// page with HX-Redirect, others with a redirect.
+func requireLogin(sessions *Sessions) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(context echo.Context) error {
+			username, ok := sessions.Username(context)
+			if !ok {
+				if context.Request().Header.Get("HX-Request") != "" {
+					context.Response().Header().Set("HX-Redirect", "/")
+					return context.NoContent(http.StatusUnauthorized)
+				}
+				return context.Redirect(http.StatusSeeOther, "/")
+			}
+			context.Set(usernameKey, username)
+			return next(context)
+		}
+	}
+}
+
+// requireAdmin only lets through users listed in ADMIN_USERS, a comma
+// separated list of usernames. It must run after requireLogin.
+func requireAdmin(admins []string) echo.MiddlewareFunc {
+	allowed := map[string]bool{}
+	for _, admin := range admins {
+		if admin = strings.TrimSpace(admin); admin != "" {
+			allowed[admin] = true
+		}
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(context echo.Context) error {
+			if !allowed[sessionUsername(context)] {
+				return echo.NewHTTPError(http.StatusForbidden, "admin access required")
+			}
+			return next(context)
+		}
+	}
+}
+
+// requireRoll only lets through users on the election's voter roll. Passkeys
+// are registered per user rather than per election, so being able to log in
+// says nothing about the roll. It must run after requireLogin.
+func requireRoll(store PasskeyStore, electionID string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(context echo.Context) error {
+			if !store.OnRoll(electionID, sessionUsername(context)) {
+				return newAppError(ErrForbidden, "You are not on the voter roll for this election.", nil)
+			}
+			return next(context)
+		}
+	}
+}
+
+func sessionUsername(context echo.Context) string {
+	username, _ := context.Get(usernameKey).(string)
+	return username
+}
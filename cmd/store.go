@@ -1,53 +1,197 @@
 package main
 
-import "github.com/go-webauthn/webauthn/webauthn"
+import (
+	"sync"
+	"time"
 
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// sessionTTL bounds how long an abandoned WebAuthn ceremony's session is kept
+// when its SessionData carries no expiry of its own.
+const sessionTTL = 5 * time.Minute
+
+// sessionExpiry honors SessionData.Expires and otherwise expires the session
+// sessionTTL after it is saved.
+func sessionExpiry(data webauthn.SessionData, now time.Time) time.Time {
+	if !data.Expires.IsZero() {
+		return data.Expires
+	}
+	return now.Add(sessionTTL)
+}
+
+// StoreStats is the PasskeyStore's contribution to the app's metrics.
+// ExpiredSessions counts sessions dropped unused since the app started.
+type StoreStats struct {
+	Users           int `json:"users"`
+	ActiveSessions  int `json:"activeSessions"`
+	ExpiredSessions int `json:"expiredSessions"`
+}
+
+// sessionExpirer is anything holding sessions that the janitor should expire.
+type sessionExpirer interface {
+	ExpireSessions(now time.Time) int
+}
+
+// startJanitor expires the stores' sessions every interval until stop is
+// called.
+func startJanitor(interval time.Duration, log Logger, stores ...sessionExpirer) (stop func()) {
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				for _, store := range stores {
+					if expired := store.ExpireSessions(now); expired > 0 {
+						log.Printf("[INFO] expired %d sessions", expired)
+					}
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+type inMemSession struct {
+	data    webauthn.SessionData
+	expires time.Time
+}
+
+// InMem keeps users and sessions in memory, which suits tests and demos. It
+// is safe for concurrent use by echo handlers and the janitor. Users are
+// copied in and out, so handlers changing a user's credentials never share
+// them with a concurrent request until SaveUser.
 type InMem struct {
-	users    map[string]PasskeyUser
-	sessions map[string]webauthn.SessionData
+	mu          sync.Mutex
+	users       map[string]*User
+	sessions    map[string]inMemSession
+	expired     int
+	roll        map[string]bool
+	invitations map[string]Invitation
 
 	log Logger
 }
 
 func NewInMem(log Logger) *InMem {
 	return &InMem{
-		users:    make(map[string]PasskeyUser),
-		sessions: make(map[string]webauthn.SessionData),
-		log:      log,
+		users:       make(map[string]*User),
+		sessions:    make(map[string]inMemSession),
+		roll:        make(map[string]bool),
+		invitations: make(map[string]Invitation),
+		log:         log,
 	}
 }
 
 func (i *InMem) GetSession(token string) webauthn.SessionData {
-	i.log.Printf("[DEBUG] GetSession: %v", i.sessions[token])
-	return i.sessions[token]
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	session, ok := i.sessions[token]
+	if ok && !time.Now().Before(session.expires) {
+		i.log.Printf("[DEBUG] GetSession: %v expired", token)
+		delete(i.sessions, token)
+		i.expired++
+		return webauthn.SessionData{}
+	}
+	i.log.Printf("[DEBUG] GetSession: %v", session.data)
+	return session.data
 }
 
 func (i *InMem) SaveSession(token string, data webauthn.SessionData) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
 	i.log.Printf("[DEBUG] SaveSession: %s - %v", token, data)
-	i.sessions[token] = data
+	i.sessions[token] = inMemSession{
+		data:    data,
+		expires: sessionExpiry(data, time.Now()),
+	}
 }
 
 func (i *InMem) DeleteSession(token string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
 	i.log.Printf("[DEBUG] DeleteSession: %v", token)
 	delete(i.sessions, token)
 }
 
-func (i *InMem) GetUser(userName string) PasskeyUser {
-	i.log.Printf("[DEBUG] GetUser: %v", userName)
-	if _, ok := i.users[userName]; !ok {
-		i.log.Printf("[DEBUG] GetUser: creating new user: %v", userName)
-		i.users[userName] = &User{
-			ID:          []byte(userName),
-			DisplayName: userName,
-			Name:        userName,
+// ExpireSessions drops sessions that expired by now and returns how many.
+func (i *InMem) ExpireSessions(now time.Time) int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	expired := 0
+	for token, session := range i.sessions {
+		if !now.Before(session.expires) {
+			delete(i.sessions, token)
+			expired++
 		}
 	}
+	i.expired += expired
+	return expired
+}
 
-	return i.users[userName]
+func (i *InMem) Stats() StoreStats {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return StoreStats{
+		Users:           len(i.users),
+		ActiveSessions:  len(i.sessions),
+		ExpiredSessions: i.expired,
+	}
+}
+
+func (i *InMem) GetUser(userName string) (PasskeyUser, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.log.Printf("[DEBUG] GetUser: %v", userName)
+	user, ok := i.users[userName]
+	if !ok {
+		return nil, false
+	}
+	return copyUser(user), true
 }
 
 func (i *InMem) SaveUser(user PasskeyUser) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
 	i.log.Printf("[DEBUG] SaveUser: %v", user.WebAuthnName())
 	i.log.Printf("[DEBUG] SaveUser: %v", user)
-	i.users[user.WebAuthnName()] = user
+	i.users[user.WebAuthnName()] = copyUser(user)
+}
+
+func rollKey(electionID string, username string) string {
+	return electionID + "\x00" + username
+}
+
+func (i *InMem) AddToRoll(electionID string, username string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.roll[rollKey(electionID, username)] = true
+}
+
+func (i *InMem) OnRoll(electionID string, username string) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.roll[rollKey(electionID, username)]
+}
+
+func (i *InMem) SaveInvitation(key string, invitation Invitation) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.invitations[key] = invitation
+}
+
+func (i *InMem) GetInvitation(key string) (Invitation, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	invitation, ok := i.invitations[key]
+	return invitation, ok
+}
+
+func (i *InMem) DeleteInvitation(key string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	delete(i.invitations, key)
 }
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	bolt "go.etcd.io/bbolt"
+)
+
+func discardLogger() Logger {
+	return log.New(io.Discard, "", 0)
+}
+
+// eachStore runs test against a new InMem and a new Bolt in a temporary file.
+func eachStore(t *testing.T, test func(t *testing.T, store PasskeyStore)) {
+	t.Run("InMem", func(t *testing.T) {
+		test(t, NewInMem(discardLogger()))
+	})
+	t.Run("Bolt", func(t *testing.T) {
+		store, err := NewBolt(filepath.Join(t.TempDir(), "passkeys.db"), discardLogger())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer store.Close()
+		test(t, store)
+	})
+}
+
+func TestStoreUsers(t *testing.T) {
+	eachStore(t, func(t *testing.T, store PasskeyStore) {
+		if _, ok := store.GetUser("alice"); ok {
+			t.Fatal("GetUser() found a user that was never saved")
+		}
+		user := NewUser("alice")
+		user.AddCredential(&webauthn.Credential{ID: []byte("key")})
+		store.SaveUser(user)
+
+		stored, ok := store.GetUser("alice")
+		if !ok {
+			t.Fatal("GetUser() found no user after SaveUser")
+		}
+		if stored.WebAuthnName() != "alice" || len(stored.WebAuthnCredentials()) != 1 {
+			t.Errorf("GetUser() = %s with %d credentials, want alice with 1", stored.WebAuthnName(), len(stored.WebAuthnCredentials()))
+		}
+		if users := store.Stats().Users; users != 1 {
+			t.Errorf("Stats().Users = %d, want 1", users)
+		}
+	})
+}
+
+// TestStoreConcurrentLogin runs the store side of FinishLogin for one user
+// from many requests at once; run it with -race.
+func TestStoreConcurrentLogin(t *testing.T) {
+	eachStore(t, func(t *testing.T, store PasskeyStore) {
+		user := NewUser("alice")
+		user.AddCredential(&webauthn.Credential{ID: []byte("key")})
+		store.SaveUser(user)
+
+		// Every request looks the user up before any of them updates it, as
+		// when logins overlap.
+		var looked, wg sync.WaitGroup
+		start := make(chan struct{})
+		for n := 0; n < 20; n++ {
+			looked.Add(1)
+			wg.Add(1)
+			go func(n int) {
+				defer wg.Done()
+				user, ok := store.GetUser("alice")
+				looked.Done()
+				if !ok {
+					t.Error("GetUser() found no user")
+					return
+				}
+				<-start
+				credential := webauthn.Credential{ID: []byte("key")}
+				credential.Authenticator.SignCount = uint32(n)
+				user.UpdateCredential(&credential)
+				store.SaveUser(user)
+			}(n)
+		}
+		looked.Wait()
+		close(start)
+		wg.Wait()
+
+		stored, ok := store.GetUser("alice")
+		if !ok {
+			t.Fatal("GetUser() found no user")
+		}
+		if credentials := stored.WebAuthnCredentials(); len(credentials) != 1 {
+			t.Errorf("user has %d credentials, want 1", len(credentials))
+		}
+	})
+}
+
+func TestStoreGetUserReturnsCopy(t *testing.T) {
+	eachStore(t, func(t *testing.T, store PasskeyStore) {
+		store.SaveUser(NewUser("alice"))
+
+		user, _ := store.GetUser("alice")
+		user.AddCredential(&webauthn.Credential{ID: []byte("key")})
+
+		stored, _ := store.GetUser("alice")
+		if credentials := stored.WebAuthnCredentials(); len(credentials) != 0 {
+			t.Errorf("stored user has %d credentials before SaveUser, want 0", len(credentials))
+		}
+	})
+}
+
+func TestStoreSessionExpiry(t *testing.T) {
+	eachStore(t, func(t *testing.T, store PasskeyStore) {
+		now := time.Now()
+		store.SaveSession("live", webauthn.SessionData{UserID: []byte("alice"), Expires: now.Add(time.Hour)})
+		store.SaveSession("stale", webauthn.SessionData{UserID: []byte("bob"), Expires: now.Add(-time.Second)})
+		store.SaveSession("default", webauthn.SessionData{UserID: []byte("carol")})
+
+		if session := store.GetSession("stale"); len(session.UserID) != 0 {
+			t.Errorf("GetSession() returned the expired session of %s", session.UserID)
+		}
+		if session := store.GetSession("live"); string(session.UserID) != "alice" {
+			t.Errorf("GetSession() = %q, want alice", session.UserID)
+		}
+
+		if expired := store.ExpireSessions(now.Add(sessionTTL / 2)); expired != 0 {
+			t.Errorf("ExpireSessions() before the TTL = %d, want 0", expired)
+		}
+		// Only the session without an expiry of its own is due at the TTL.
+		if expired := store.ExpireSessions(now.Add(sessionTTL + time.Second)); expired != 1 {
+			t.Errorf("ExpireSessions() after the TTL = %d, want 1", expired)
+		}
+		stats := store.Stats()
+		if stats.ActiveSessions != 1 || stats.ExpiredSessions != 2 {
+			t.Errorf("Stats() = %+v, want 1 active and 2 expired sessions", stats)
+		}
+
+		store.DeleteSession("live")
+		if session := store.GetSession("live"); len(session.UserID) != 0 {
+			t.Error("GetSession() returned a deleted session")
+		}
+	})
+}
+
+func TestStoreInvitations(t *testing.T) {
+	eachStore(t, func(t *testing.T, store PasskeyStore) {
+		links, err := importRoll(store, "lunch", strings.NewReader("email\nAlice\nbob\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(links) != 2 || links[0].Username != "alice" || links[1].Username != "bob" {
+			t.Fatalf("importRoll() = %+v, want invitations for alice and bob", links)
+		}
+		if !store.OnRoll("lunch", "alice") || store.OnRoll("lunch", "email") || store.OnRoll("dinner", "alice") {
+			t.Error("roll does not hold exactly alice and bob for lunch")
+		}
+		token := strings.TrimPrefix(links[0].Link, "/?invite=")
+
+		if err := checkInvitation(store, token, "bob"); err == nil {
+			t.Error("checkInvitation() accepted alice's invitation for bob")
+		}
+		if err := checkInvitation(store, "", "alice"); err == nil {
+			t.Error("checkInvitation() accepted an empty token")
+		}
+		if err := checkInvitation(store, token, " Alice "); err != nil {
+			t.Errorf("checkInvitation() = %v, want nil", err)
+		}
+
+		// FinishRegistration consumes the invitation.
+		store.DeleteInvitation(invitationKey(token))
+		if err := checkInvitation(store, token, "alice"); err == nil {
+			t.Error("checkInvitation() accepted a used invitation")
+		}
+
+		store.SaveInvitation(invitationKey("old"), Invitation{ElectionID: "lunch", Username: "bob", Expires: time.Now().Add(-time.Second)})
+		if err := checkInvitation(store, "old", "bob"); err == nil {
+			t.Error("checkInvitation() accepted an expired invitation")
+		}
+		store.SaveInvitation(invitationKey("stranger"), Invitation{ElectionID: "lunch", Username: "carol", Expires: time.Now().Add(time.Hour)})
+		if err := checkInvitation(store, "stranger", "carol"); err == nil {
+			t.Error("checkInvitation() accepted an invitation for a voter not on the roll")
+		}
+	})
+}
+
+// writeBoltSchema creates a store file at path as an app with only the first
+// version migrations would have left it, with a session left behind.
+func writeBoltSchema(t *testing.T, path string, version int) {
+	t.Helper()
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, migration := range migrations[:version] {
+			err := migration(tx)
+			if err != nil {
+				return err
+			}
+		}
+		if sessions := tx.Bucket(sessionsBucket); sessions != nil {
+			err := sessions.Put([]byte("old"), []byte(`{"challenge":"abc"}`))
+			if err != nil {
+				return err
+			}
+		}
+		meta, err := tx.CreateBucket(metaBucket)
+		if err != nil {
+			return err
+		}
+		versionJSON, err := json.Marshal(version)
+		if err != nil {
+			return err
+		}
+		return meta.Put(schemaVersionKey, versionJSON)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBoltMigrations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "passkeys.db")
+	writeBoltSchema(t, path, 1)
+
+	store, err := NewBolt(path, discardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sessions := store.Stats().ActiveSessions; sessions != 0 {
+		t.Errorf("%d sessions survived the sessions migration, want 0", sessions)
+	}
+	store.AddToRoll("lunch", "alice")
+	if !store.OnRoll("lunch", "alice") {
+		t.Error("OnRoll() = false after AddToRoll on a migrated store")
+	}
+	var version int
+	err = store.db.View(func(tx *bolt.Tx) error {
+		return json.Unmarshal(tx.Bucket(metaBucket).Get(schemaVersionKey), &version)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != len(migrations) {
+		t.Errorf("schema version = %d, want %d", version, len(migrations))
+	}
+	store.Close()
+
+	// A migrated store reopens without running anything again.
+	store, err = NewBolt(path, discardLogger())
+	if err != nil {
+		t.Fatalf("reopening a migrated store: %v", err)
+	}
+	if !store.OnRoll("lunch", "alice") {
+		t.Error("roll lost on reopening a migrated store")
+	}
+	store.Close()
+}
+
+func TestBoltRefusesNewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "passkeys.db")
+	writeBoltSchema(t, path, len(migrations))
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		versionJSON, err := json.Marshal(len(migrations) + 1)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(metaBucket).Put(schemaVersionKey, versionJSON)
+	})
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewBolt(path, discardLogger())
+	if err == nil {
+		store.Close()
+		t.Fatal("NewBolt() opened a store written by a newer app")
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+// votePageSize is how many ballots the admin listing shows per page.
+const votePageSize = 25
+
+// Vote mirrors a ballot as returned by QueryVotesPaginated.
+type Vote struct {
+	ID         string         `json:"id"`
+	ElectionID string         `json:"electionId"`
+	Candidate  string         `json:"candidate"`
+	Rankings   []string       `json:"rankings"`
+	Approvals  []string       `json:"approvals"`
+	Scores     map[string]int `json:"scores"`
+	BallotHash string         `json:"ballotHash"`
+}
+
+// Ballot summarizes the vote's choices by candidate ID.
+func (v Vote) Ballot() string {
+	switch {
+	case len(v.Rankings) > 0:
+		return strings.Join(v.Rankings, " > ")
+	case len(v.Approvals) > 0:
+		return strings.Join(v.Approvals, ", ")
+	case len(v.Scores) > 0:
+		candidates := []string{}
+		for candidate := range v.Scores {
+			candidates = append(candidates, candidate)
+		}
+		sort.Strings(candidates)
+		scores := []string{}
+		for _, candidate := range candidates {
+			scores = append(scores, fmt.Sprintf("%s: %d", candidate, v.Scores[candidate]))
+		}
+		return strings.Join(scores, ", ")
+	}
+	return v.Candidate
+}
+
+// VotePage mirrors the chaincode's VotePage.
+type VotePage struct {
+	Votes        []Vote `json:"votes"`
+	Bookmark     string `json:"bookmark"`
+	FetchedCount int32  `json:"fetchedCount"`
+}
+
+func queryVotes(contract *client.Contract, electionID string, bookmark string) (*VotePage, error) {
+	var page VotePage
+	err := evaluate(contract, &page, "QueryVotesPaginated", electionID, strconv.Itoa(votePageSize), bookmark)
+	if err != nil {
+		return nil, err
+	}
+	return &page, nil
+}